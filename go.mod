@@ -0,0 +1,5 @@
+module github.com/zyxw59/conlang
+
+go 1.18
+
+require golang.org/x/text v0.14.0
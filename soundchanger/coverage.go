@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/zyxw59/conlang/sounds"
+)
+
+// printCoverage applies the sound changes to each word of a lexicon, and
+// prints a table of how many words each rule matched and changed, and how
+// many of those changes were undone, followed by the rules which never
+// matched and those whose every change was undone, or the same as JSON
+func printCoverage(cache *sounds.Cache, files []string, words []sounds.Word, asJSON bool) error {
+	cv, err := cache.CoverageFiles(words, files...)
+	if err != nil {
+		return err
+	}
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetEscapeHTML(false)
+		return enc.Encode(cv)
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "rule\tmatched\tchanged\tundone")
+	for _, rc := range cv.Rules {
+		fmt.Fprintf(tw, "%s:%d  %s\t%d\t%d\t%d\n", rc.File, rc.Line, rc.Rule, rc.Matched, rc.Changed, rc.Undone)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	fmt.Printf("\n%d words\n", cv.Words)
+	for _, list := range []struct {
+		title string
+		rules []sounds.RuleCoverage
+	}{
+		{"rules which never matched", cv.Dead()},
+		{"rules whose every change was undone", cv.AlwaysUndone()},
+	} {
+		if len(list.rules) == 0 {
+			continue
+		}
+		fmt.Printf("\n%s:\n", list.title)
+		for _, rc := range list.rules {
+			fmt.Printf("\t%s:%d  %s\n", rc.File, rc.Line, rc.Rule)
+		}
+	}
+	return nil
+}
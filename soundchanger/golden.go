@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/zyxw59/conlang/sounds"
+	"github.com/zyxw59/conlang/transcription"
+)
+
+// goldenEntries applies the sound changes to each word of a lexicon, and
+// returns the entries for a golden file, written in the output scheme. The
+// spelled output is only transcribed if it is not produced by a romanizer
+func goldenEntries(cache *sounds.Cache, files []string, words []sounds.Word, to *transcription.Scheme, romanized bool) ([]sounds.GoldenEntry, error) {
+	entries, err := cache.GoldenFiles(words, files...)
+	if err != nil {
+		return nil, err
+	}
+	for i := range entries {
+		e := &entries[i]
+		e.Word.Text = to.FromIPA(e.Word.Text)
+		if !romanized {
+			e.Output = to.FromIPA(e.Output)
+		}
+		for j := range e.Steps {
+			e.Steps[j].Output = to.FromIPA(e.Steps[j].Output)
+		}
+		for j := range e.Trace {
+			e.Trace[j].Input, e.Trace[j].Output = to.FromIPA(e.Trace[j].Input), to.FromIPA(e.Trace[j].Output)
+		}
+	}
+	return entries, nil
+}
+
+// compareGolden applies the sound changes to each word of a lexicon, and
+// prints how the output differs from the golden file, as described for
+// printDiffs. If accept is true, the golden file is then replaced with the new
+// output. It reports whether the output was the same as the golden file
+func compareGolden(cache *sounds.Cache, files []string, words []sounds.Word, filename string, accept bool, to *transcription.Scheme) (bool, error) {
+	old, err := sounds.LoadGolden(filename)
+	if err != nil {
+		return false, err
+	}
+	rls, err := cache.LoadFiles(files...)
+	if err != nil {
+		return false, err
+	}
+	entries, err := goldenEntries(cache, files, words, to, spelledByRomanizer(rls))
+	if err != nil {
+		return false, err
+	}
+	diffs := sounds.CompareGolden(old, entries)
+	printDiffs(diffs)
+	if accept {
+		if err := sounds.SaveGolden(filename, entries); err != nil {
+			return false, err
+		}
+	}
+	return len(diffs) == 0, nil
+}
+
+// compareRevisions applies the sound changes as they were at two git
+// revisions to each word of a lexicon, and prints how the output differs, as
+// described for printDiffs. The revisions are given as `old..new`, or as
+// `old` to compare with the working tree, as described for
+// sounds.ParseRevisions. The new caches have the same
+// settings as the given one. It reports whether the output was the same
+func compareRevisions(newLanguages func(*sounds.Cache) languages, cache *sounds.Cache, words []sounds.Word, revisions string, to *transcription.Scheme) (bool, error) {
+	old, new, err := sounds.ParseRevisions(revisions)
+	if err != nil {
+		return false, err
+	}
+	revs := [2]string{old, new}
+	var entries [2][]sounds.GoldenEntry
+	for i, rev := range revs {
+		c := sounds.NewCache()
+		if rev != "" {
+			c = sounds.NewRevisionCache(rev)
+		}
+		c.PreserveCase, c.MaxCandidates, c.Sentence = cache.PreserveCase, cache.MaxCandidates, cache.Sentence
+		files, err := newLanguages(c).files()
+		if err != nil {
+			return false, err
+		}
+		rls, err := c.LoadFiles(files...)
+		if err != nil {
+			return false, err
+		}
+		if entries[i], err = goldenEntries(c, files, words, to, spelledByRomanizer(rls)); err != nil {
+			return false, err
+		}
+	}
+	diffs := sounds.CompareGolden(entries[0], entries[1])
+	printDiffs(diffs)
+	return len(diffs) == 0, nil
+}
+
+// printDiffs prints each word which was added (`+`), removed (`-`) or whose
+// output changed (`~`), with the rules its new (`+`) and old (`-`) outputs
+// diverge on, and the output of each, followed by a summary
+func printDiffs(diffs []sounds.GoldenDiff) {
+	counts := make(map[sounds.DiffKind]int)
+	for _, d := range diffs {
+		counts[d.Kind]++
+		switch d.Kind {
+		case sounds.DiffAdded:
+			fmt.Printf("+ %s\t%s\n", d.New.Word, d.New.Output)
+		case sounds.DiffRemoved:
+			fmt.Printf("- %s\t%s\n", d.Old.Word, d.Old.Output)
+		case sounds.DiffChanged:
+			fmt.Printf("~ %s\t%s > %s\n", d.New.Word, d.Old.Output, d.New.Output)
+			for _, st := range d.Gained {
+				fmt.Printf("\t+ %s:%d\t%s\t%s\n", st.File, st.Line, st.Text, st.Output)
+			}
+			for _, s := range d.Lost {
+				fmt.Printf("\t- %s\t%s\n", s.Rule, s.Output)
+			}
+		}
+	}
+	fmt.Printf("%d added, %d removed, %d changed\n", counts[sounds.DiffAdded], counts[sounds.DiffRemoved], counts[sounds.DiffChanged])
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/zyxw59/conlang/sounds"
+)
+
+// interactionExamples is the number of example words printed for each
+// interaction
+const interactionExamples = 5
+
+// printInteractions applies the sound changes to each word of a lexicon, and
+// prints each pair of rules of the same file whose order matters for some of
+// the words, with the kind of interaction, the number of words which show it
+// and some examples of them, with their output in the given order and with
+// the two rules swapped, or the same as JSON. If graph is not empty, the
+// interactions are also written to it as a DOT graph
+func printInteractions(cache *sounds.Cache, files []string, words []sounds.Word, graph string, asJSON bool) error {
+	in, err := cache.InteractionsFiles(words, interactionExamples, files...)
+	if err != nil {
+		return err
+	}
+	if graph != "" {
+		if err := os.WriteFile(graph, []byte(in.DOT()), 0644); err != nil {
+			return err
+		}
+	}
+	list := in.List()
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetEscapeHTML(false)
+		return enc.Encode(struct {
+			Words        int                  `json:"words"`
+			Interactions []sounds.Interaction `json:"interactions"`
+		}{in.Words, list})
+	}
+	for _, i := range list {
+		from, to := i.Direction()
+		fmt.Printf("%s  %s  %s  (%d of %d words)\n", from, i.Kind, to, i.Count, in.Words)
+		for _, ex := range i.Examples {
+			fmt.Printf("\t%s > %s, swapped %s\n", ex.Word.Text, ex.Output, ex.Swapped)
+		}
+	}
+	fmt.Printf("\n%d words, %d interactions\n", in.Words, len(list))
+	return nil
+}
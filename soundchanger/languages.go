@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/zyxw59/conlang/sounds"
+)
+
+// languages resolves the languages given on the command line into the sound
+// change files to apply
+type languages interface {
+	// files returns the files which are applied going forward, which in
+	// branch mode are the files leading down to the second language
+	files() ([]string, error)
+	// route returns the files on the route between the two languages, as
+	// described for sounds.Route
+	route() (above, up, down []string, err error)
+	// test runs the tests declared in the files which are applied going
+	// forward
+	test() ([]sounds.TestResult, error)
+}
+
+// pairLanguages are languages given as pairs of dot-separated file names
+type pairLanguages struct {
+	cache  *sounds.Cache
+	prefix string
+	pairs  []string
+	// branch is whether the pairs are a route between two branches
+	branch bool
+}
+
+func (l pairLanguages) files() ([]string, error) {
+	if l.branch {
+		_, _, down, err := l.route()
+		return down, err
+	}
+	return sounds.PairFiles(l.prefix, l.pairs...)
+}
+
+func (l pairLanguages) route() (above, up, down []string, err error) {
+	above, up, down, err = sounds.Route(l.pairs[0], l.pairs[1])
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return prefixed(l.prefix, above), prefixed(l.prefix, up), prefixed(l.prefix, down), nil
+}
+
+func (l pairLanguages) test() ([]sounds.TestResult, error) {
+	return l.cache.TestPairs(l.prefix, l.pairs...)
+}
+
+// prefixed returns the names, each with a prefix
+func prefixed(prefix string, names []string) []string {
+	out := make([]string, len(names))
+	for i, n := range names {
+		out[i] = prefix + n
+	}
+	return out
+}
+
+// treeLanguages are two nodes of a tree manifest
+type treeLanguages struct {
+	cache    *sounds.Cache
+	manifest string
+	from, to string
+	// branch is whether the nodes are in different branches of the tree
+	branch bool
+}
+
+func newTreeLanguages(cache *sounds.Cache, manifest string, names []string, branch bool) (treeLanguages, error) {
+	if len(names) != 2 {
+		return treeLanguages{}, fmt.Errorf("a tree manifest requires exactly two languages")
+	}
+	return treeLanguages{cache: cache, manifest: manifest, from: names[0], to: names[1], branch: branch}, nil
+}
+
+func (l treeLanguages) files() ([]string, error) {
+	if l.branch {
+		_, _, down, err := l.route()
+		return down, err
+	}
+	tree, err := l.cache.LoadTree(l.manifest)
+	if err != nil {
+		return nil, err
+	}
+	return tree.Descent(l.from, l.to)
+}
+
+func (l treeLanguages) route() (above, up, down []string, err error) {
+	tree, err := l.cache.LoadTree(l.manifest)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return tree.Route(l.from, l.to)
+}
+
+func (l treeLanguages) test() ([]sounds.TestResult, error) {
+	tree, err := l.cache.LoadTree(l.manifest)
+	if err != nil {
+		return nil, err
+	}
+	return l.cache.TestTree(tree, l.from, l.to)
+}
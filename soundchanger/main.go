@@ -5,37 +5,418 @@ import (
 	"flag"
 	"fmt"
 	"github.com/zyxw59/conlang/sounds"
+	"github.com/zyxw59/conlang/transcription"
+	"golang.org/x/text/unicode/norm"
 	"log"
 	"os"
 	"strings"
 )
 
+// modes are the subcommands which can be given before the languages
+var modes = map[string]bool{
+	"tree": true, "blame": true, "test": true, "coverage": true, "interactions": true,
+}
+
+// terminated reports whether the arguments after the flags follow `--`, in
+// which case they are all languages, even if the first is the name of a mode
+func terminated() bool {
+	i := len(os.Args) - flag.NArg() - 1
+	return i > 0 && os.Args[i] == "--"
+}
+
 func main() {
-	verbose := flag.Bool("v", false, "verbose: print debug output")
+	var verbose verbosity
+	flag.Var(&verbose, "v", "verbose: print the rules which change each word; repeat to add comments as headings, or give 3 to print every line")
 	quiet := flag.Bool("q", false, "quiet: do not print prompts")
 	prefix := flag.String("p", "", "prefix for sound change files")
+	tagged := flag.Bool("t", false, "tagged: read tab-separated tags after each word")
+	text := flag.Bool("s", false, "sentence: treat each line as running text")
+	unknown := flag.Bool("u", false, "unknown: warn about segments missing from the inventory")
+	normalize := flag.String("n", "", "normalize: convert input to a normalization form (nfc or nfd)")
+	preserveCase := flag.Bool("c", false, "case: match case-insensitively and preserve capitalization")
+	both := flag.Bool("o", false, "orthography: print the phonemic form before the spelled form")
+	inScheme := flag.String("i", "ipa", "input: transcription scheme of the input (ipa, xsampa, kirshenbaum or cxs)")
+	branch := flag.Bool("b", false, "branch: find cognates in the second language of words in the first")
+	derivation := flag.Bool("e", false, "derivation: print the form of each word after each file")
+	reverse := flag.Bool("r", false, "reverse: print the possible ancestors of each word")
+	maxCandidates := flag.Int("m", sounds.DefaultMaxCandidates, "max: the maximum number of candidates considered in reverse mode")
+	table := flag.String("d", "", "descendants: print a cognate table (tsv or markdown) of every descendant of the language")
+	manifest := flag.String("f", "", "tree: resolve the two languages through a tree manifest file")
+	golden := flag.String("g", "", "golden: compare the output for a lexicon read from stdin with a golden file")
+	revisions := flag.String("R", "", "revisions: compare the output for a lexicon read from stdin between two git revisions of the files (old..new, or old and the working tree)")
+	graph := flag.String("G", "", "graph: with interactions, also write the interactions as a DOT graph to a file")
+	accept := flag.Bool("a", false, "accept: with -g, update the golden file with the new output")
+	jsonTrace := flag.Bool("j", false, "json: print debug output as a JSON trace")
+	outScheme := flag.String("x", "ipa", "output: transcription scheme of the output (ipa, xsampa, kirshenbaum or cxs)")
 
 	flag.Parse()
 
 	pairs := flag.Args()
 	cache := sounds.NewCache()
-	_, err := cache.LoadPairs(*prefix, pairs...)
+	// mode is a subcommand given before the languages
+	mode := ""
+	if len(pairs) > 0 && modes[pairs[0]] && !terminated() {
+		mode, pairs = pairs[0], pairs[1:]
+	}
+	if mode == "tree" {
+		if err := printTree(cache, *manifest, *prefix, pairs); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	blame := mode == "blame"
+	cache.PreserveCase, cache.Sentence = *preserveCase, *text
+	from, err := transcription.Lookup(*inScheme)
+	if err != nil {
+		log.Fatal(err)
+	}
+	to, err := transcription.Lookup(*outScheme)
+	if err != nil {
+		log.Fatal(err)
+	}
+	reader := wordReader{tagged: *tagged, scheme: from}
+	if *normalize != "" {
+		f, err := sounds.ParseForm(*normalize)
+		if err != nil {
+			log.Fatal(err)
+		}
+		reader.form = &f
+	}
+	if *table != "" {
+		if len(pairs) != 1 {
+			log.Fatal("descendants mode requires exactly one language")
+		}
+		err = printCognates(cache, *manifest, *prefix, pairs[0], *table, reader, to)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	cache.MaxCandidates = *maxCandidates
+	if (*reverse || *branch || *derivation) && *text {
+		log.Fatal("reverse, branch and derivation modes can't be used in sentence mode")
+	}
+	if *tagged && *text {
+		log.Fatal("tagged mode can't be used in sentence mode")
+	}
+	if mode != "" && (*reverse || *branch || *derivation) {
+		log.Fatalf("%s can't be used in reverse, branch or derivation mode", mode)
+	}
+	lexicon := *golden != "" || *revisions != "" || mode == "coverage" || mode == "interactions"
+	if (*golden != "" || *revisions != "") && (mode != "" || *reverse || *branch || *derivation || *text || *golden != "" && *revisions != "") {
+		log.Fatal("golden and revision modes can't be combined with other modes")
+	}
+	if *branch && len(pairs) != 2 {
+		log.Fatal("branch mode requires exactly two languages")
+	}
+	// newLanguages resolves the languages given on the command line,
+	// loading files through a cache
+	newLanguages := func(cache *sounds.Cache) languages {
+		if *manifest != "" {
+			tl, err := newTreeLanguages(cache, *manifest, pairs, *branch)
+			if err != nil {
+				log.Fatal(err)
+			}
+			return tl
+		}
+		return pairLanguages{cache: cache, prefix: *prefix, pairs: pairs, branch: *branch}
+	}
+	langs := newLanguages(cache)
+	files, err := langs.files()
+	if err != nil {
+		log.Fatal(err)
+	}
+	rls, err := cache.LoadFiles(files...)
 	if err != nil {
 		log.Fatal(err)
 	}
+	if mode == "test" {
+		passed, err := runTests(langs)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if !passed {
+			os.Exit(1)
+		}
+		return
+	}
+	// the spelled form is only transcribed if it is not produced by a
+	// romanizer
+	romanized := spelledByRomanizer(rls)
+	if lexicon {
+		var words []sounds.Word
+		input := bufio.NewScanner(os.Stdin)
+		for input.Scan() {
+			if strings.TrimSpace(input.Text()) != "" {
+				words = append(words, reader.read(input.Text()))
+			}
+		}
+		if err := input.Err(); err != nil {
+			log.Fatal(err)
+		}
+		same := true
+		switch {
+		case mode == "coverage":
+			err = printCoverage(cache, files, words, *jsonTrace)
+		case mode == "interactions":
+			err = printInteractions(cache, files, words, *graph, *jsonTrace)
+		case *golden != "":
+			same, err = compareGolden(cache, files, words, *golden, *accept, to)
+		default:
+			same, err = compareRevisions(newLanguages, cache, words, *revisions, to)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		if !same && !*accept {
+			os.Exit(1)
+		}
+		return
+	}
+	var above, up, down []string
+	if *branch {
+		if above, up, down, err = langs.route(); err != nil {
+			log.Fatal(err)
+		}
+	}
 	if !*quiet {
 		fmt.Println("Type words to apply changes to. ^C to quit")
 	}
 	input := bufio.NewScanner(os.Stdin)
 	for input.Scan() {
-		word := input.Text()
-		output, debug, err := cache.ApplyPairs(word, *prefix, pairs...)
+		word := reader.read(input.Text())
+		if *unknown {
+			if err := checkInventory(cache, files, word); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if *branch {
+			cognates, err := cache.ApplyRoute(word, above, up, down)
+			if err != nil {
+				log.Printf("%s: %v", word.Text, err)
+				continue
+			}
+			forms := make([]string, 0, len(cognates))
+			seen := make(map[string]bool)
+			for _, c := range cognates {
+				if verbose > 0 {
+					fmt.Printf("*%s > %s\n", to.FromIPA(c.Ancestor.Text), to.FromIPA(c.Phonemic.Text))
+				}
+				form := c.Spelled.Text
+				if !romanized {
+					form = to.FromIPA(form)
+				}
+				if !seen[form] {
+					seen[form] = true
+					forms = append(forms, form)
+				}
+			}
+			fmt.Println(strings.Join(forms, " "))
+			continue
+		}
+		if *reverse {
+			candidates, err := cache.UnapplyFiles(word, files...)
+			if err != nil {
+				log.Printf("%s: %v", word.Text, err)
+				continue
+			}
+			forms := make([]string, len(candidates))
+			for i, c := range candidates {
+				forms[i] = to.FromIPA(c.Text)
+			}
+			fmt.Println(strings.Join(forms, " "))
+			continue
+		}
+		res, err := cache.ApplyChain(word, files...)
 		if err != nil {
 			log.Fatal(err)
 		}
-		if *verbose {
-			fmt.Println(strings.Join(debug, "\n"))
+		if verbose > 0 || *jsonTrace {
+			printTrace(res.Trace, verbose, *jsonTrace)
+		}
+		if *derivation {
+			forms := []string{"*" + to.FromIPA(word.Text)}
+			for _, st := range res.Stages {
+				forms = append(forms, to.FromIPA(st.Output.Text))
+			}
+			derived := strings.Join(forms, " > ")
+			if romanized {
+				derived += fmt.Sprintf(" ⟨%s⟩", res.Spelled.Text)
+			}
+			fmt.Println(derived)
+			continue
+		}
+		phonemic, spelled := res.Phonemic.Text, res.Spelled.Text
+		if blame {
+			printBlame(res.Trace.Blame(), to.FromIPA(phonemic), to)
+			continue
+		}
+		if !romanized {
+			spelled = to.FromIPA(spelled)
+		}
+		phonemic = to.FromIPA(phonemic)
+		if *both {
+			fmt.Printf("%s\t%s\n", phonemic, spelled)
+		} else {
+			fmt.Println(spelled)
+		}
+	}
+}
+
+// spelledByRomanizer reports whether the output of a series of files is
+// spelled with a romanizer, which is that of the last file
+func spelledByRomanizer(rls []*sounds.RuleList) bool {
+	return len(rls) > 0 && rls[len(rls)-1].Romanizer() != nil
+}
+
+// checkInventory warns about any segments of a word which are not in the
+// segment inventory of a sound change file, checking the form of the word
+// each file is given
+func checkInventory(cache *sounds.Cache, files []string, word sounds.Word) error {
+	rls, err := cache.LoadFiles(files...)
+	if err != nil {
+		return err
+	}
+	res, err := cache.ApplyChain(word, files...)
+	if err != nil {
+		// the error is reported when the word is applied
+		return nil
+	}
+	i := 0
+	for _, st := range res.Trace {
+		if st.Kind != sounds.StepFile || i >= len(rls) {
+			continue
+		}
+		inv := rls[i].Inventory()
+		i++
+		if inv == nil {
+			continue
+		}
+		if unknown := inv.Unknown(st.Input); len(unknown) > 0 {
+			log.Printf("%s: segments not in the inventory of %s: %s", word.Text, st.File, strings.Join(unknown, " "))
+		}
+	}
+	return nil
+}
+
+// wordReader reads lines of input as words
+type wordReader struct {
+	// form is the normalization form input is converted to, if any
+	form *norm.Form
+	// tagged is whether each line has tags after the word
+	tagged bool
+	// scheme is the transcription scheme of the input
+	scheme *transcription.Scheme
+}
+
+// read reads a line of input as a word
+func (r wordReader) read(line string) sounds.Word {
+	if r.form != nil {
+		line = r.form.String(line)
+	}
+	word := sounds.Word{Text: line}
+	if r.tagged {
+		word = sounds.ParseWord(line)
+	}
+	word.Text = r.scheme.ToIPA(word.Text)
+	return word
+}
+
+// loadTree loads the language tree, either from a tree manifest, or
+// discovered from the files starting with the prefix
+func loadTree(cache *sounds.Cache, manifest, prefix string) (*sounds.Tree, error) {
+	if manifest != "" {
+		return cache.LoadTree(manifest)
+	}
+	return sounds.ScanTree(prefix)
+}
+
+// printTree prints the language tree, as loaded by loadTree, in the format
+// given by args, which is `ascii` (the default) or `dot`. Gaps in a
+// discovered tree are reported
+func printTree(cache *sounds.Cache, manifest, prefix string, args []string) error {
+	tree, err := loadTree(cache, manifest, prefix)
+	if err != nil {
+		return err
+	}
+	format := "ascii"
+	if len(args) > 0 {
+		format = args[0]
+	}
+	switch format {
+	case "ascii":
+		fmt.Print(tree.ASCII())
+	case "dot":
+		fmt.Print(tree.DOT())
+	default:
+		return fmt.Errorf("unknown tree format %#v", format)
+	}
+	for _, name := range tree.Missing() {
+		log.Printf("%s has descendants, but no sound change file", name)
+	}
+	return nil
+}
+
+// printCognates reads a lexicon from stdin, and prints a table with a row for
+// each word, and a column for each descendant of the root language, in the
+// given format, which is `tsv` or `markdown`
+func printCognates(cache *sounds.Cache, manifest, prefix, root, format string, reader wordReader, to *transcription.Scheme) error {
+	tree, err := loadTree(cache, manifest, prefix)
+	if err != nil {
+		return err
+	}
+	descendants, err := tree.Descendants(root)
+	if err != nil {
+		return err
+	}
+	header := []string{tree.Nodes[root].DisplayName()}
+	for _, n := range descendants {
+		header = append(header, n.DisplayName())
+	}
+	var writeRow func(cells []string)
+	switch format {
+	case "tsv":
+		writeRow = func(cells []string) {
+			fmt.Println(strings.Join(cells, "\t"))
+		}
+		writeRow(header)
+	case "markdown", "md":
+		writeRow = func(cells []string) {
+			escaped := make([]string, len(cells))
+			for i, c := range cells {
+				escaped[i] = strings.Replace(c, "|", "\\|", -1)
+			}
+			fmt.Printf("| %s |\n", strings.Join(escaped, " | "))
+		}
+		writeRow(header)
+		rule := make([]string, len(header))
+		for i := range rule {
+			rule[i] = "---"
+		}
+		fmt.Printf("|%s|\n", strings.Join(rule, "|"))
+	default:
+		return fmt.Errorf("unknown table format %#v", format)
+	}
+	input := bufio.NewScanner(os.Stdin)
+	for input.Scan() {
+		line := input.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		word := reader.read(line)
+		reflexes, err := cache.ApplyDescendants(word, tree, root)
+		if err != nil {
+			return err
+		}
+		row := []string{to.FromIPA(word.Text)}
+		for _, r := range reflexes {
+			if r.Romanized {
+				row = append(row, r.Spelled.Text)
+			} else {
+				row = append(row, to.FromIPA(r.Phonemic.Text))
+			}
 		}
-		fmt.Println(output)
+		writeRow(row)
 	}
+	return input.Err()
 }
@@ -0,0 +1,30 @@
+package main
+
+import "fmt"
+
+// runTests runs the tests declared in the sound change files, and prints each
+// failure, followed by the rules which changed the word, and a summary. It
+// reports whether every test passed
+func runTests(langs languages) (bool, error) {
+	results, err := langs.test()
+	if err != nil {
+		return false, err
+	}
+	passed := 0
+	for _, r := range results {
+		if r.Passed() {
+			passed++
+			continue
+		}
+		if r.Err != nil {
+			fmt.Printf("FAIL %s:%d: %s => %s: %v\n", r.File, r.Line, r.Input, r.Output, r.Err)
+			continue
+		}
+		fmt.Printf("FAIL %s:%d: %s => %s, got %s\n", r.File, r.Line, r.Input, r.Output, r.Got)
+		for _, st := range r.Trace.Sections() {
+			fmt.Printf("\t%v\n", st)
+		}
+	}
+	fmt.Printf("%d of %d tests passed\n", passed, len(results))
+	return passed == len(results), nil
+}
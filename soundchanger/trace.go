@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/zyxw59/conlang/sounds"
+	"github.com/zyxw59/conlang/transcription"
+)
+
+// The levels of verbose output
+const (
+	// changesLevel shows only the steps which change the word
+	changesLevel = 1 + iota
+	// sectionsLevel also shows the file and comment above each change
+	sectionsLevel
+	// fullLevel shows every line of every file
+	fullLevel
+)
+
+// ANSI escape sequences used to highlight the changed parts of a word
+const (
+	highlightStart = "\x1b[1;4m"
+	highlightEnd   = "\x1b[0m"
+)
+
+// verbosity is a flag which counts how many times it is given, or which can
+// be set to a level directly, as in `-v=3`
+type verbosity int
+
+func (v *verbosity) String() string {
+	return strconv.Itoa(int(*v))
+}
+
+func (v *verbosity) Set(s string) error {
+	switch s {
+	case "true":
+		*v++
+	case "false":
+		*v = 0
+	default:
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return err
+		}
+		*v = verbosity(n)
+	}
+	return nil
+}
+
+func (v *verbosity) IsBoolFlag() bool {
+	return true
+}
+
+// printTrace prints the steps of the trace selected by the level of
+// verbosity, either as debugging strings or as a single line of JSON. If no
+// level is given, the JSON includes every step. When writing to a terminal,
+// the parts of the word changed by each rule are highlighted
+func printTrace(trace sounds.Trace, level verbosity, asJSON bool) {
+	switch {
+	case level == changesLevel:
+		trace = trace.Changed()
+	case level == sectionsLevel:
+		trace = trace.Sections()
+	}
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(trace); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	color := isTerminal(os.Stdout)
+	for _, st := range trace {
+		if color && st.Kind == sounds.StepRule {
+			fmt.Printf("%s  %s\n", st.Text, highlight(st.Output, st.Replacements))
+		} else {
+			fmt.Println(st)
+		}
+	}
+}
+
+// printBlame prints the phonemic form of a word, followed by each of its
+// spans on its own line, with the location and text of the line which
+// produced it, or `-` if it is unchanged from the input
+func printBlame(blame []sounds.Blame, phonemic string, to *transcription.Scheme) {
+	fmt.Println(phonemic)
+	for _, b := range blame {
+		if b.Step == nil {
+			fmt.Printf("\t%s\t-\n", to.FromIPA(b.Text))
+			continue
+		}
+		loc := b.Step.File
+		if b.Step.Line > 0 {
+			loc = fmt.Sprintf("%s:%d", loc, b.Step.Line)
+		}
+		text := b.Step.Text
+		if text == "" {
+			text = string(b.Step.Kind)
+		}
+		fmt.Printf("\t%s\t%s\t%s\n", to.FromIPA(b.Text), loc, text)
+	}
+}
+
+// highlight marks the given spans of a string with ANSI escape sequences.
+// Empty spans, where something was deleted, are not marked
+func highlight(s string, spans [][2]int) string {
+	out := make([]byte, 0, len(s))
+	last := 0
+	for _, sp := range spans {
+		if sp[0] == sp[1] {
+			continue
+		}
+		out = append(out, s[last:sp[0]]...)
+		out = append(out, highlightStart...)
+		out = append(out, s[sp[0]:sp[1]]...)
+		out = append(out, highlightEnd...)
+		last = sp[1]
+	}
+	return string(append(out, s[last:]...))
+}
+
+// isTerminal reports whether a file is a terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
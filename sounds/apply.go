@@ -6,9 +6,9 @@ import (
 )
 
 type Match struct {
-	Start   int
-	End     int
-	Indices map[int]int
+	Start   int         `json:"start"`
+	End     int         `json:"end"`
+	Indices map[int]int `json:"indices,omitempty"`
 }
 
 func (m Match) Equal(other Match) bool {
@@ -37,90 +37,268 @@ func (m Match) Equal(other Match) bool {
 }
 
 // Apply applies all the rules in a RuleList to a word and returns its new
-// value, along with the debugging strings, or an error value
-func (rl *RuleList) Apply(word string) (output string, debug []string, err error) {
-	output = word
-	debug = make([]string, len(rl.Lines))
+// value, along with the trace of the rules applied, or an error value
+func (rl *RuleList) Apply(word string) (output string, trace Trace, err error) {
+	text, trace, err := rl.apply(singleWord(word), nil, nil)
+	if err != nil {
+		return "", trace, err
+	}
+	return text.Words[0], trace, nil
+}
+
+// ApplyWord applies all the rules in a RuleList to a tagged word, skipping
+// rules whose tag conditions the word does not meet, and returns its new
+// value, along with the trace of the rules applied, or an error value
+func (rl *RuleList) ApplyWord(word Word) (output Word, trace Trace, err error) {
+	text, trace, err := rl.apply(singleWord(word.Text), word.Tags, nil)
+	if err != nil {
+		return Word{}, trace, err
+	}
+	return Word{Text: text.Words[0], Tags: word.Tags}, trace, nil
+}
+
+// ApplyText applies all the rules in a RuleList to a piece of running text.
+// The text is split into words and separators, as described for ParseText,
+// and each rule is applied to each word separately, except for sandhi rules,
+// which are applied across the boundaries between words, as described for
+// applyRule. The text is then reassembled with its separators
+func (rl *RuleList) ApplyText(text string) (output string, trace Trace, err error) {
+	t, trace, err := rl.apply(ParseText(text), nil, nil)
+	if err != nil {
+		return "", trace, err
+	}
+	return t.String(), trace, nil
+}
+
+// apply applies all the rules in a RuleList to a text whose words have the
+// given tags, re-applying the persistent rules inherited from earlier files in
+// a chain, as well as those in the RuleList itself, after every line that
+// changes the text. The text is normalized first, and if the RuleList
+// preserves case, converted to lower case, with the original capitalization
+// restored at the end
+func (rl *RuleList) apply(text Text, tags Tags, inherited []*CompiledRule) (output Text, trace Trace, err error) {
+	output = rl.normalizeText(text)
+	if rl.settings.preserveCase {
+		var patterns []CasePattern
+		output, patterns = output.lowerCase()
+		defer func() {
+			if err == nil {
+				output = output.restoreCase(patterns)
+			}
+		}()
+	}
+	trace = make(Trace, 0, len(rl.Lines))
+	persistent := make([]*CompiledRule, len(inherited), len(inherited)+len(rl.Lines))
+	copy(persistent, inherited)
 	for i, l := range rl.Lines {
-		output, debug[i], err = l.Apply(output)
+		var step Step
+		prev := output
+		output, step, err = applyLine(l, output, tags)
+		step.File, step.Line = rl.Filename, rl.lineNumber(i)
+		trace = append(trace, step)
 		if err != nil {
-			return "", debug, err
+			return Text{}, trace, err
+		}
+		if !output.Equal(prev) {
+			output, trace, err = reapply(persistent, output, tags, trace)
+			if err != nil {
+				return Text{}, trace, err
+			}
+		}
+		if cr, ok := l.(*CompiledRule); ok && cr.Persist != NotPersistent {
+			persistent = append(persistent, cr)
 		}
 	}
-	return output, debug, nil
+	return output, trace, nil
 }
 
-// Apply applies the rule to the string, and returns its new value
+// maxReapplications is the maximum number of times the persistent rules are
+// re-applied in a row before reapply gives up
+const maxReapplications = 100
+
+// reapply re-applies a list of persistent rules to a text, adding steps to the
+// trace only for the rules which change the text. The rules are re-applied
+// until none of them changes the text, so that `ww > w ; persist` leaves no
+// geminate behind, even after a line which creates three glides in a row. It
+// is an error if the rules never settle on a form
+func reapply(rules []*CompiledRule, text Text, tags Tags, trace Trace) (Text, Trace, error) {
+	seen := map[string]bool{text.String(): true}
+	for n := 0; n < maxReapplications; n++ {
+		changed := false
+		for _, cr := range rules {
+			output, matches, spans, err := applyRule(cr, text, tags)
+			step := Step{
+				Kind:         StepRule,
+				File:         cr.file,
+				Line:         cr.line,
+				Text:         cr.String(),
+				Input:        text.String(),
+				Output:       output.String(),
+				Matches:      matches,
+				Replacements: spans,
+				Persistent:   true,
+			}
+			if err != nil {
+				return Text{}, append(trace, step), err
+			}
+			if !output.Equal(text) {
+				trace = append(trace, step)
+				text, changed = output, true
+			}
+		}
+		if !changed {
+			return text, trace, nil
+		}
+		if seen[text.String()] {
+			break
+		}
+		seen[text.String()] = true
+	}
+	return Text{}, trace, fmt.Errorf("persist error: the persistent rules never settle on a form of %#v", text.String())
+}
+
+// chainPersistent returns the rules in the RuleList which persist into later
+// files of a chain
+func (rl *RuleList) chainPersistent() []*CompiledRule {
+	var rules []*CompiledRule
+	for _, l := range rl.Lines {
+		if cr, ok := l.(*CompiledRule); ok && cr.Persist == PersistChain {
+			rules = append(rules, cr)
+		}
+	}
+	return rules
+}
+
+// Apply applies the rule to the string, and returns its new value. The string
+// is treated as a word with no tags
 func (cr *CompiledRule) Apply(word string) (output, debug string, err error) {
+	return cr.ApplyTagged(word, nil)
+}
+
+// ApplyTagged applies the rule to the string, which has the given tags, and
+// returns its new value. If the tags do not meet the conditions of the rule,
+// the string is returned unchanged
+func (cr *CompiledRule) ApplyTagged(word string, tags Tags) (output, debug string, err error) {
+	output, _, _, err = cr.applyMatches(word, tags)
+	if err != nil {
+		return "", fmt.Sprintf("%v  %v", cr, word), err
+	}
+	return output, fmt.Sprintf("%v  %v", cr, output), nil
+}
+
+// applyMatches is like ApplyTagged, but returns the places the rule matched,
+// and the spans of the output which replaced them, instead of a debugging
+// string
+func (cr *CompiledRule) applyMatches(word string, tags Tags) (output string, matches []Match, spans [][2]int, err error) {
+	if !cr.AppliesTo(tags) {
+		return word, nil, nil, nil
+	}
 	// first, get matches:
-	matches := cr.FindMatches(word)
+	matches = cr.FindMatches(word)
 	if len(matches) == 0 {
 		// no matches, do nothing
-		return word, fmt.Sprintf("%v  %v", cr, word), nil
+		return word, nil, nil, nil
 	}
-	parts := make([]string, 2*len(matches)+1)
-	parts[0] = word[:matches[0].Start]
+	var b strings.Builder
+	b.WriteString(word[:matches[0].Start])
+	spans = make([][2]int, len(matches))
 	for i, m := range matches {
-		repl, err := cr.Categories.Replace(cr.To, m.Indices)
+		repl, err := cr.Categories.replace(cr.To, m.Indices, cr.unnumbered, cr.form)
 		if err != nil {
-			return "", fmt.Sprintf("%v  %v", cr, word), err
+			return "", nil, nil, err
 		}
-		parts[2*i+1] = repl
+		spans[i][0] = b.Len()
+		b.WriteString(repl)
+		spans[i][1] = b.Len()
 		if i == len(matches)-1 {
-			parts[2*i+2] = word[m.End:]
+			b.WriteString(word[m.End:])
 		} else {
-			parts[2*i+2] = word[m.End:matches[i+1].Start]
+			b.WriteString(word[m.End:matches[i+1].Start])
 		}
 	}
-	output = strings.Join(parts, "")
-	return output, fmt.Sprintf("%v  %v", cr, output), nil
+	return b.String(), matches, spans, nil
 }
 
 // FindMatches finds and returns a list of all valid matches of the rule in the
 // word
 func (cr *CompiledRule) FindMatches(word string) []Match {
-	// First, match on the From field
-	initialMatches := cr.From.FindAllStringIndex(word, -1)
-	// initialize final matches array to have length zero, but enough
-	// capacity to fit all initial matches
-	finalMatches := make([]Match, 0, len(initialMatches))
-	// now, check each match for validity
-	for _, m := range initialMatches {
+	// if there is a segment inventory, matches must start and end on
+	// segment boundaries
+	var bounds map[int]bool
+	if cr.segments != nil {
+		bounds = cr.segments.boundaries(word)
+	}
+	aligned := func(pos int) bool {
+		return bounds == nil || bounds[pos]
+	}
+	// check checks a match of the From field for validity, returning the
+	// indices of its numbered categories, or nil if it is not valid
+	check := func(m []int) map[int]int {
+		if !aligned(m[0]) || !aligned(m[1]) {
+			return nil
+		}
 		indices := cr.From.categoryMatch(word[m[0]:m[1]], nil)
 		// If the match fails to match numbered categories, discard
 		if indices == nil {
-			continue
+			return nil
 		}
 		// Search up to the initial match. The Before pattern will
 		// always end with `$`, so it must match the end of the string,
 		// i.e., right before the initial match
-		indices = cr.Before.categoryMatch(word[:m[0]], indices)
-		if indices == nil {
-			continue
+		indices, span := cr.Before.categoryMatchSpan(word[:m[0]], indices)
+		if indices == nil || !aligned(span[0]) {
+			return nil
 		}
 		// Search starting at the end of the initial match. The After
 		// pattern will always start with `^`, so it must match the
 		// begining of the string, i.e., right after the initial match
-		indices = cr.After.categoryMatch(word[m[1]:], indices)
-		if indices == nil {
-			continue
+		indices, span = cr.After.categoryMatchSpan(word[m[1]:], indices)
+		if indices == nil || !aligned(m[1]+span[1]) {
+			return nil
 		}
 		// If UnBefore matches, discard
-		if cr.UnBefore.categoryMatch(word[:m[0]], indices) != nil {
-			continue
+		if idxs, span := cr.UnBefore.categoryMatchSpan(word[:m[0]], indices); idxs != nil && aligned(span[0]) {
+			return nil
 		}
 		// If UnAfter matches, discard
-		if cr.UnAfter.categoryMatch(word[m[1]:], indices) != nil {
-			continue
+		if idxs, span := cr.UnAfter.categoryMatchSpan(word[m[1]:], indices); idxs != nil && aligned(m[1]+span[1]) {
+			return nil
+		}
+		return indices
+	}
+	finalMatches := make([]Match, 0)
+	if bounds == nil {
+		// First, match on the From field, then check each match for
+		// validity
+		for _, m := range cr.From.FindAllStringIndex(word, -1) {
+			if indices := check(m); indices != nil {
+				finalMatches = append(finalMatches, Match{Start: m[0], End: m[1], Indices: indices})
+			}
 		}
-		// if we've made it this far, we've got a match
-		finalMatches = append(finalMatches, Match{
-			Start:   m[0],
-			End:     m[1],
-			Indices: indices,
-		})
+		return cr.filterPosition(word, finalMatches)
 	}
-	return finalMatches
+	// With a segment inventory, a rejected match may overlap a valid one,
+	// so after each rejected match, search again from the next segment
+	// boundary
+	for pos := 0; pos <= len(word); {
+		loc := cr.From.FindStringIndex(word[pos:])
+		if loc == nil {
+			break
+		}
+		m := []int{pos + loc[0], pos + loc[1]}
+		if indices := check(m); indices != nil {
+			finalMatches = append(finalMatches, Match{Start: m[0], End: m[1], Indices: indices})
+			if m[1] > m[0] {
+				pos = m[1]
+				continue
+			}
+		}
+		pos = m[0] + 1
+		for pos < len(word) && !bounds[pos] {
+			pos++
+		}
+	}
+	return cr.filterPosition(word, finalMatches)
 }
 
 // categoryMatch checks whether a string matches a compiledPattern, and if it
@@ -129,15 +307,28 @@ func (cr *CompiledRule) FindMatches(word string) []Match {
 // For instance, if a pattern `{0:C}` matched the third element of category
 // `C`, this function would return map[int]int{0: 3}
 func (cp *compiledPattern) categoryMatch(word string, indices map[int]int) map[int]int {
+	idxs, _ := cp.categoryMatchSpan(word, indices)
+	return idxs
+}
+
+// categoryMatchSpan is like categoryMatch, but also returns the start and end
+// of the match in the string
+func (cp *compiledPattern) categoryMatchSpan(word string, indices map[int]int) (map[int]int, []int) {
 	// if this pattern is nil, it can't match anything
 	if cp == nil {
-		return nil
+		return nil, nil
 	}
-	// match has type []string
-	match := cp.FindStringSubmatch(word)
-	if len(match) == 0 {
+	loc := cp.FindStringSubmatchIndex(word)
+	if loc == nil {
 		// no match
-		return nil
+		return nil, nil
+	}
+	// match has type []string
+	match := make([]string, len(loc)/2)
+	for i := range match {
+		if loc[2*i] >= 0 {
+			match[i] = word[loc[2*i]:loc[2*i+1]]
+		}
 	}
 	idxs := make(map[int]int)
 	if indices != nil {
@@ -157,7 +348,7 @@ func (cp *compiledPattern) categoryMatch(word string, indices map[int]int) map[i
 		prev, ok := idxs[n]
 		if ok && prev != idx {
 			// the same number matched different indices
-			return nil
+			return nil, nil
 		}
 		// otherwise set the index (if it's already set, we're merely
 		// resetting it with the same value, so no need to check ok)
@@ -165,5 +356,5 @@ func (cp *compiledPattern) categoryMatch(word string, indices map[int]int) map[i
 	}
 	// assuming we made it out of the loop alive, idxs is fully
 	// populated from the match (and any previous indices)
-	return idxs
+	return idxs, loc[:2]
 }
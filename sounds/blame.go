@@ -0,0 +1,108 @@
+package sounds
+
+// A Blame is a span of the output of a trace, along with the step which last
+// changed it
+type Blame struct {
+	Text string `json:"text"`
+	// Start and End are the byte offsets of the span in the output
+	Start int `json:"start"`
+	End   int `json:"end"`
+	// Step is the step which produced the span, or nil if the span is
+	// unchanged from the input of the trace
+	Step *Step `json:"step,omitempty"`
+	// Source is the span of the input of the step which it replaced, or,
+	// if the span is unchanged, the span of the input of the trace which
+	// it comes from
+	Source [2]int `json:"source"`
+}
+
+// origin records where a byte of the text in a trace came from: the step and
+// the match of the step which produced it, or, for a byte of the input, a
+// step of -1 and its position in the input. A match of -1 is a step which
+// replaced the whole text
+type origin struct {
+	step, match, pos int
+}
+
+// inputOrigins returns the origins of the bytes of an input string
+func inputOrigins(s string) []origin {
+	origins := make([]origin, len(s))
+	for i := range origins {
+		origins[i] = origin{step: -1, pos: i}
+	}
+	return origins
+}
+
+// Blame divides the phonemic output of the trace into spans, each produced by
+// a single match of a single rule, or unchanged from the input. The input is
+// the text after deromanization, if any, and romanization is ignored. If a
+// line other than a rule changes the text, it is blamed for all of it
+func (t Trace) Blame() []Blame {
+	if len(t) == 0 {
+		return nil
+	}
+	text := t[0].Input
+	origins := inputOrigins(text)
+steps:
+	for i, st := range t {
+		switch {
+		case st.Kind == StepRomanize:
+			break steps
+		case st.Kind == StepDeromanize:
+			text = st.Output
+			origins = inputOrigins(text)
+			continue
+		case st.Input != text:
+			// the text was normalized at the start of a file, even
+			// if its length is the same, so start again from there
+			origins = inputOrigins(st.Input)
+		}
+		if !st.Changed() {
+			text = st.Output
+			continue
+		}
+		if len(st.Replacements) != len(st.Matches) || len(st.Matches) == 0 {
+			origins = make([]origin, len(st.Output))
+			for k := range origins {
+				origins[k] = origin{step: i, match: -1}
+			}
+			text = st.Output
+			continue
+		}
+		next := make([]origin, 0, len(st.Output))
+		last := 0
+		for j, m := range st.Matches {
+			next = append(next, origins[last:m.Start]...)
+			for k := st.Replacements[j][0]; k < st.Replacements[j][1]; k++ {
+				next = append(next, origin{step: i, match: j})
+			}
+			last = m.End
+		}
+		origins = append(next, origins[last:]...)
+		text = st.Output
+	}
+	var out []Blame
+	for i := 0; i < len(origins); {
+		o := origins[i]
+		j := i + 1
+		for j < len(origins) && origins[j].step == o.step && origins[j].match == o.match &&
+			(o.step >= 0 || origins[j].pos == origins[j-1].pos+1) {
+			j++
+		}
+		b := Blame{Text: text[i:j], Start: i, End: j}
+		switch {
+		case o.step < 0:
+			b.Source = [2]int{o.pos, origins[j-1].pos + 1}
+		case o.match < 0:
+			b.Step = &t[o.step]
+			b.Source = [2]int{0, len(t[o.step].Input)}
+		default:
+			b.Step = &t[o.step]
+			m := t[o.step].Matches[o.match]
+			b.Source = [2]int{m.Start, m.End}
+		}
+		out = append(out, b)
+		i = j
+	}
+	return out
+}
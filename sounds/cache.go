@@ -1,12 +1,28 @@
 package sounds
 
 import (
+	"fmt"
 	"os"
+	"sort"
 	"time"
 )
 
 type Cache struct {
 	files map[string]cachedFile
+	trees map[string]cachedTree
+	// PreserveCase is whether words are converted to lower case before
+	// applying a series of files, and have their original capitalization
+	// restored afterwards
+	PreserveCase bool
+	// MaxCandidates is the maximum number of candidates considered when
+	// reversing a series of files, as described for RuleList.Unapply
+	MaxCandidates int
+	// Sentence is whether the text of a word given to ApplyChain is
+	// running text, as described for RuleList.ApplyText
+	Sentence bool
+	// revision is the git revision files are loaded from, or the empty
+	// string to load them from the working tree
+	revision string
 }
 
 type cachedFile struct {
@@ -15,16 +31,28 @@ type cachedFile struct {
 	rl      *RuleList
 }
 
+type cachedTree struct {
+	modTime time.Time
+	tree    *Tree
+}
+
 func NewCache() *Cache {
 	return &Cache{
 		files: make(map[string]cachedFile),
+		trees: make(map[string]cachedTree),
 	}
 }
 
 // LoadFile loads a file and caches its contents, or returns the cached
 // contents if they are as new as the file
 func (c *Cache) LoadFile(filename string) (rl *RuleList, err error) {
+	if c.revision != "" {
+		return c.loadRevisionFile(filename)
+	}
 	info, err := os.Stat(filename)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("file error: sound change file %#v does not exist", filename)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -63,7 +91,7 @@ func (c *Cache) LoadFiles(files ...string) (rls []*RuleList, err error) {
 }
 
 // ApplyFile applies a sound change file to a word
-func (c *Cache) ApplyFile(word, filename string) (output string, debug []string, err error) {
+func (c *Cache) ApplyFile(word, filename string) (output string, trace Trace, err error) {
 	rl, err := c.LoadFile(filename)
 	if err != nil {
 		return "", nil, err
@@ -71,42 +99,276 @@ func (c *Cache) ApplyFile(word, filename string) (output string, debug []string,
 	return rl.Apply(word)
 }
 
-// ApplyFiles applies a series of files to a word
-func (c *Cache) ApplyFiles(word string, files ...string) (output string, debug []string, err error) {
-	debugs := make([][]string, len(files))
-	output = word
-	for i, f := range files {
-		var db []string
-		output, db, err = c.ApplyFile(output, f)
+// ApplyFiles applies a series of files to a word, and returns the phonemic
+// form of the output, as described for ApplyChain
+func (c *Cache) ApplyFiles(word string, files ...string) (output string, trace Trace, err error) {
+	res, err := c.ApplyChain(Word{Text: word}, files...)
+	return res.Phonemic.Text, res.Trace, err
+}
+
+// A ChainResult is the result of applying a series of files to a word
+type ChainResult struct {
+	// Phonemic is the phonemic form of the output, and Spelled is the form
+	// spelled with the romanizer of the last file
+	Phonemic, Spelled Word
+	// Stages are the phonemic forms of the word after each file
+	Stages []Stage
+	Trace  Trace
+}
+
+// A Stage is the phonemic form of a word after one of the files in a chain
+// has been applied to it
+type Stage struct {
+	File   string
+	Output Word
+}
+
+// ApplyChain applies a series of files to a tagged word. Rules marked as
+// persisting through the chain are re-applied in all subsequent files. If the
+// first file has a deromanizer, it is applied to the word first, and the
+// output is spelled with the romanizer of the last file. If Sentence is set,
+// the text of the word is treated as running text
+func (c *Cache) ApplyChain(word Word, files ...string) (ChainResult, error) {
+	text := singleWord(word.Text)
+	if c.Sentence {
+		text = ParseText(word.Text)
+	}
+	res, err := c.applyFiles(text, word.Tags, files, nil, true)
+	if err != nil {
+		return ChainResult{}, err
+	}
+	out := ChainResult{
+		Phonemic: Word{Text: res.phonemic.String(), Tags: word.Tags},
+		Spelled:  Word{Text: res.spelled.String(), Tags: word.Tags},
+		Stages:   make([]Stage, len(res.stages)),
+		Trace:    res.trace,
+	}
+	for i, st := range res.stages {
+		out.Stages[i] = Stage{File: files[i], Output: Word{Text: st.String(), Tags: word.Tags}}
+	}
+	return out, nil
+}
+
+// chainResult is the result of applying a series of files to a text
+type chainResult struct {
+	phonemic, spelled Text
+	// stages are the phonemic forms of the text after each file
+	stages []Text
+	trace  Trace
+}
+
+// applyFiles applies a series of files to a text whose words have the given
+// tags, and returns the phonemic and spelled forms of the output, along with
+// the form after each file. The files inherit the given persistent rules, as
+// well as those of the files before them. If deromanize is false, the text is
+// already in phonemic form, so the deromanizer of the first file is not
+// applied
+func (c *Cache) applyFiles(text Text, tags Tags, files []string, inherited []*CompiledRule, deromanize bool) (res chainResult, err error) {
+	rls, err := c.LoadFiles(files...)
+	if err != nil {
+		return chainResult{}, err
+	}
+	traces := make([]Trace, 0, len(files)+2)
+	output := text
+	if c.PreserveCase {
+		var patterns []CasePattern
+		output, patterns = output.lowerCase()
+		defer func() {
+			if err == nil {
+				res.phonemic = res.phonemic.restoreCase(patterns)
+				res.spelled = res.spelled.restoreCase(patterns)
+				for i, st := range res.stages {
+					res.stages[i] = st.restoreCase(patterns)
+				}
+			}
+		}()
+	}
+	if deromanize && len(rls) > 0 && rls[0].deromanizer != nil {
+		input := output.String()
+		output = rls[0].deromanizer.applyText(output)
+		traces = append(traces, Trace{{Kind: StepDeromanize, File: files[0], Input: input, Output: output.String()}})
+	}
+	res.stages = make([]Text, 0, len(rls))
+	persistent := inherited[:len(inherited):len(inherited)]
+	for i, rl := range rls {
+		start := Step{Kind: StepFile, File: files[i], Input: output.String(), Output: output.String()}
+		var tr Trace
+		output, tr, err = rl.apply(output, tags, persistent)
 		if err != nil {
-			return "", debug, err
+			return chainResult{}, err
+		}
+		persistent = append(persistent, rl.chainPersistent()...)
+		traces = append(traces, append(Trace{start}, tr...))
+		res.stages = append(res.stages, output)
+	}
+	res.phonemic, res.spelled = output, output
+	if len(rls) > 0 && rls[len(rls)-1].romanizer != nil {
+		res.spelled = rls[len(rls)-1].romanizer.applyText(output)
+		traces = append(traces, Trace{{Kind: StepRomanize, File: files[len(files)-1], Input: output.String(), Output: res.spelled.String()}})
+	}
+	res.trace = joinTraces(traces...)
+	return res, nil
+}
+
+// UnapplyFiles returns the words which a series of files could have changed
+// into the given tagged word, sorted. The word is treated as the phonemic form
+// of the output, so orthographies are not used, and the candidates are
+// phonemic forms as they are before the first file
+func (c *Cache) UnapplyFiles(word Word, files ...string) ([]Word, error) {
+	candidates, err := c.unapplyFiles(word.Text, word.Tags, files, nil)
+	if err != nil {
+		return nil, err
+	}
+	words := make([]Word, len(candidates))
+	for i, cand := range candidates {
+		words[i] = Word{Text: cand, Tags: word.Tags}
+	}
+	return words, nil
+}
+
+// unapplyFiles reverses a series of files, from last to first, taking into
+// account the persistent rules each file inherits from the ones before it, and
+// the given persistent rules, which the first file inherits
+func (c *Cache) unapplyFiles(word string, tags Tags, files []string, inherited []*CompiledRule) (candidates []string, err error) {
+	rls, err := c.LoadFiles(files...)
+	if err != nil {
+		return nil, err
+	}
+	max := c.MaxCandidates
+	if max <= 0 {
+		max = DefaultMaxCandidates
+	}
+	chain := make([][]*CompiledRule, len(rls))
+	persistent := inherited
+	for i, rl := range rls {
+		chain[i] = persistent
+		persistent = append(persistent[:len(persistent):len(persistent)], rl.chainPersistent()...)
+	}
+	text := singleWord(word)
+	if c.PreserveCase {
+		var patterns []CasePattern
+		text, patterns = text.lowerCase()
+		defer func() {
+			for i, cand := range candidates {
+				candidates[i] = singleWord(cand).restoreCase(patterns).Words[0]
+			}
+		}()
+	}
+	candidates = []string{text.Words[0]}
+	for i := len(rls) - 1; i >= 0; i-- {
+		var next []string
+		seen := make(map[string]bool)
+		for _, cand := range candidates {
+			prev, err := rls[i].unapply(cand, tags, chain[i], max)
+			if err != nil {
+				return nil, err
+			}
+			for _, p := range prev {
+				if !seen[p] {
+					seen[p] = true
+					next = append(next, p)
+				}
+			}
 		}
-		debugs[i] = make([]string, 1, len(db)+1)
-		debugs[i][0] = f
-		debugs[i] = append(debugs[i], db...)
+		if len(next) > max {
+			return nil, ErrTooManyCandidates
+		}
+		candidates = next
+	}
+	sort.Strings(candidates)
+	return candidates, nil
+}
+
+// PairFiles returns the files for a series of pairs of names, as described
+// for Pairs, using a prefix for all filenames
+func PairFiles(prefix string, names ...string) ([]string, error) {
+	pairs, err := Pairs(names...)
+	if err != nil {
+		return nil, err
 	}
-	return output, stringSliceConcat(debugs...), nil
+	return prefixSlice(pairs, prefix), nil
 }
 
 // LoadPairs loads multiple files and caches their contents, using a prefix for
 // all filenames. It returns cached content if the cache is as recent as the
 // files
 func (c *Cache) LoadPairs(prefix string, names ...string) ([]*RuleList, error) {
-	pairs, err := Pairs(names...)
+	files, err := PairFiles(prefix, names...)
 	if err != nil {
 		return nil, err
 	}
-	files := prefixSlice(pairs, prefix)
 	return c.LoadFiles(files...)
 }
 
 // ApplyPairs applies a series of sound changes to a word, using a prefix for
 // all filenames
-func (c *Cache) ApplyPairs(word, prefix string, names ...string) (string, []string, error) {
-	pairs, err := Pairs(names...)
+func (c *Cache) ApplyPairs(word, prefix string, names ...string) (string, Trace, error) {
+	files, err := PairFiles(prefix, names...)
 	if err != nil {
 		return "", nil, err
 	}
-	files := prefixSlice(pairs, prefix)
 	return c.ApplyFiles(word, files...)
 }
+
+// A Cognate is a form reached by following a route through the language tree,
+// along with the ancestor it was derived from
+type Cognate struct {
+	Ancestor, Phonemic, Spelled Word
+}
+
+// ApplyRoute follows a route through the language tree, as described for
+// Route. The word is treated as the phonemic form of a word of the first
+// language, and the files up are reversed to find its possible ancestors, as
+// described for UnapplyFiles. The files down are then applied to each
+// ancestor, and the resulting cognates are returned, sorted by ancestor. Both
+// directions re-apply the rules persisting through the chain in the files
+// above, which lead down to the common ancestor
+func (c *Cache) ApplyRoute(word Word, above, up, down []string) ([]Cognate, error) {
+	rls, err := c.LoadFiles(above...)
+	if err != nil {
+		return nil, err
+	}
+	var inherited []*CompiledRule
+	for _, rl := range rls {
+		inherited = append(inherited, rl.chainPersistent()...)
+	}
+	candidates, err := c.unapplyFiles(word.Text, word.Tags, up, inherited)
+	if err != nil {
+		return nil, err
+	}
+	cognates := make([]Cognate, len(candidates))
+	for i, cand := range candidates {
+		a := Word{Text: cand, Tags: word.Tags}
+		res, err := c.applyFiles(singleWord(a.Text), a.Tags, down, inherited, false)
+		if err != nil {
+			return nil, err
+		}
+		cognates[i] = Cognate{
+			Ancestor: a,
+			Phonemic: Word{Text: res.phonemic.Words[0], Tags: a.Tags},
+			Spelled:  Word{Text: res.spelled.Words[0], Tags: a.Tags},
+		}
+	}
+	return cognates, nil
+}
+
+// LoadTree loads a tree manifest file and caches it, or returns the cached
+// Tree if it is as new as the file
+func (c *Cache) LoadTree(filename string) (*Tree, error) {
+	if c.revision != "" {
+		return c.loadRevisionTree(filename)
+	}
+	info, err := os.Stat(filename)
+	if err != nil {
+		return nil, err
+	}
+	if ct, ok := c.trees[filename]; ok && !ct.modTime.Before(info.ModTime()) {
+		return ct.tree, nil
+	}
+	t, err := LoadTree(filename)
+	if err != nil {
+		return nil, err
+	}
+	c.trees[filename] = cachedTree{modTime: info.ModTime(), tree: t}
+	return t, nil
+}
@@ -0,0 +1,96 @@
+package sounds
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// A CasePattern is a pattern of capitalization of a word
+type CasePattern int
+
+const (
+	// LowerCase words have no upper case letters
+	LowerCase CasePattern = iota
+	// TitleCase words have an upper case first letter, and no other upper
+	// case letters
+	TitleCase
+	// UpperCase words have more than one upper case letter, and no lower
+	// case letters
+	UpperCase
+	// MixedCase words have any other pattern of capitalization, which
+	// can't be re-applied to a word the rules have changed, so they are
+	// left in lower case
+	MixedCase
+)
+
+// DetectCase returns the pattern of capitalization of a word. Only letters are
+// counted, so a word whose only letter is upper case, such as `A`, is title
+// case rather than upper case
+func DetectCase(word string) CasePattern {
+	var upper, lower, letters int
+	firstUpper := false
+	for _, r := range word {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		switch {
+		case unicode.IsUpper(r) || unicode.IsTitle(r):
+			if letters == 0 {
+				firstUpper = true
+			}
+			upper++
+		case unicode.IsLower(r):
+			lower++
+		}
+		letters++
+	}
+	switch {
+	case upper == 0:
+		return LowerCase
+	case firstUpper && upper == 1:
+		return TitleCase
+	case lower == 0:
+		return UpperCase
+	}
+	return MixedCase
+}
+
+// Apply applies the pattern of capitalization to a lower case word. Lower
+// case and mixed case words are returned unchanged
+func (p CasePattern) Apply(word string) string {
+	switch p {
+	case TitleCase:
+		i := strings.IndexFunc(word, unicode.IsLetter)
+		if i < 0 {
+			return word
+		}
+		r, n := utf8.DecodeRuneInString(word[i:])
+		return word[:i] + string(unicode.ToTitle(r)) + word[i+n:]
+	case UpperCase:
+		return strings.ToUpper(word)
+	}
+	return word
+}
+
+// lowerCase converts each word of a text to lower case, and returns the
+// original patterns of capitalization
+func (t Text) lowerCase() (Text, []CasePattern) {
+	words := make([]string, len(t.Words))
+	patterns := make([]CasePattern, len(t.Words))
+	for i, w := range t.Words {
+		patterns[i] = DetectCase(w)
+		words[i] = strings.ToLower(w)
+	}
+	return t.withWords(words), patterns
+}
+
+// restoreCase re-applies the patterns of capitalization returned by lowerCase
+// to each word of a text
+func (t Text) restoreCase(patterns []CasePattern) Text {
+	words := make([]string, len(t.Words))
+	for i, w := range t.Words {
+		words[i] = patterns[i].Apply(w)
+	}
+	return t.withWords(words)
+}
@@ -5,6 +5,8 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+
+	"golang.org/x/text/unicode/norm"
 )
 
 // A CategoryList is a map of strings to categories
@@ -13,37 +15,57 @@ type CategoryList map[string]*Category
 // Replace replaces all instances of a numbered category with the
 // appropriate element of that category
 func (cl CategoryList) Replace(text string, indices map[int]int) (string, error) {
+	return cl.replace(text, indices, nil, nil)
+}
+
+// replace replaces all instances of a category with the appropriate element of
+// that category, and applies any diacritic operations following it. Numbered
+// categories are looked up in indices by their number. The n-th occurrence of
+// an unnumbered category is looked up by the n-th number assigned to that
+// category in unnumbered. The results of diacritic operations are converted
+// to the given normalization form, as described for applyDiacritics
+func (cl CategoryList) replace(text string, indices map[int]int, unnumbered map[string][]int, form *norm.Form) (string, error) {
 	var err error
+	seen := make(map[string]int)
 	replacer := func(match string) string {
 		if err != nil {
 			// if there's already an error, don't bother
 			return ""
 		}
-		groups := catMatcher.FindStringSubmatch(match)
+		groups := replMatcher.FindStringSubmatch(match)
 		cat, ok := cl[groups[2]]
 		if !ok {
 			err = fmt.Errorf("replacement error: category %#v is not defined", groups[2])
 			return ""
 		}
+		var n int
 		if groups[1] == "" {
-			// unnumbered category in replacement text, error
-			err = fmt.Errorf("replacement error: unnumbered category %#v in replacement text", groups[2])
-			return ""
-		}
-		// numbered category
-		n, err_ := strconv.Atoi(groups[1])
-		if err_ != nil {
-			err = err_
-			return ""
+			// unnumbered category, which refers to the same
+			// occurrence of the category in the match
+			nums := unnumbered[groups[2]]
+			if seen[groups[2]] >= len(nums) {
+				err = fmt.Errorf("replacement error: unnumbered category %#v in replacement text does not occur in the match", groups[2])
+				return ""
+			}
+			n = nums[seen[groups[2]]]
+			seen[groups[2]]++
+		} else {
+			// numbered category
+			var err_ error
+			n, err_ = strconv.Atoi(groups[1])
+			if err_ != nil {
+				err = err_
+				return ""
+			}
 		}
 		i := indices[n]
 		if i >= cat.Length() || i < 0 {
 			err = fmt.Errorf("replacement error: invalid index %#v for category %#v", i, groups[2])
 			return ""
 		}
-		return cat.Get(i)
+		return applyDiacritics(cat.Get(i), groups[3], form)
 	}
-	return catMatcher.ReplaceAllStringFunc(text, replacer), err
+	return replMatcher.ReplaceAllStringFunc(text, replacer), err
 }
 
 // Equal compares two CategoryLists by value
@@ -65,13 +87,18 @@ func (cl CategoryList) Equal(other CategoryList) bool {
 
 // A Category is a set of sounds
 type Category struct {
-	values  []string
-	sorted  []string
+	values []string
+	sorted []string
+	// patterns are the elements of the category, along with their
+	// precomposed and decomposed forms, sorted from longest to shortest
+	patterns []string
+	// indices maps each element, and each of its forms, to its index
 	indices map[string]int
 	Name    string
 }
 
-// NewCategory returns a category from a []string
+// NewCategory returns a category from a []string. The category matches its
+// elements whether they are written precomposed or decomposed
 func NewCategory(name string, elements []string) *Category {
 	c := &Category{
 		values:  elements,
@@ -89,6 +116,21 @@ func NewCategory(name string, elements []string) *Category {
 		}
 	}
 	sort.Sort(c)
+	seen := make(map[string]bool)
+	for _, e := range c.sorted {
+		for _, f := range []string{e, norm.NFC.String(e), norm.NFD.String(e)} {
+			if _, ok := c.indices[f]; !ok {
+				c.indices[f] = c.indices[e]
+			}
+			if !seen[f] {
+				seen[f] = true
+				c.patterns = append(c.patterns, f)
+			}
+		}
+	}
+	sort.SliceStable(c.patterns, func(i, j int) bool {
+		return len(c.patterns[i]) > len(c.patterns[j])
+	})
 	return c
 }
 
@@ -131,9 +173,10 @@ func (c *Category) ElemString() string {
 }
 
 // Pattern writes the category as a `|`-separated list, for use in a regular
-// expression
+// expression, including both the precomposed and decomposed forms of each
+// element
 func (c *Category) Pattern() string {
-	return strings.Join(c.sorted, "|")
+	return strings.Join(c.patterns, "|")
 }
 
 // Get returns the i-th element of the category
@@ -5,13 +5,14 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
-)
 
-const (
-	wordStart = `(?:\s+|^)`
-	wordEnd   = `(?:\s+|$)`
+	"golang.org/x/text/unicode/norm"
 )
 
+// defaultBoundary matches the characters which separate words, if a RuleList
+// has no boundary directive
+const defaultBoundary = `\s`
+
 // catMatcher matches a category between curly braces. Category names must
 // start with a letter, and may not contain whitespace or '}'
 var catMatcher = regexp.MustCompile(`\{(?:(\d+):)?(\p{L}[^}\s]*)\}`)
@@ -31,6 +32,23 @@ type CompiledRule struct {
 	To                               string
 	Before, After, UnBefore, UnAfter *compiledPattern
 	Categories                       CategoryList
+	Persist                          Persistence
+	Require, Forbid                  []string
+	Nth, Syllable                    int
+	Sandhi                           bool
+	nucleus                          *compiledPattern
+	segments                         *Inventory
+	// boundary matches a single character which separates words, and is
+	// the same boundary `#` was compiled with
+	boundary *regexp.Regexp
+	// unnumbered maps the names of unnumbered categories in From which
+	// are referred to in To to the numbers assigned to their occurrences
+	unnumbered map[string][]int
+	// form is the normalization form of the RuleList the rule belongs to
+	form *norm.Form
+	// file and line are where the rule was parsed from, if known
+	file string
+	line int
 	string
 }
 
@@ -60,6 +78,24 @@ func (cr *CompiledRule) Equal(other *CompiledRule) bool {
 	if !cr.Categories.Equal(other.Categories) {
 		return false
 	}
+	if cr.Persist != other.Persist {
+		return false
+	}
+	if !stringSliceEqual(cr.Require, other.Require) {
+		return false
+	}
+	if !stringSliceEqual(cr.Forbid, other.Forbid) {
+		return false
+	}
+	if cr.Nth != other.Nth || cr.Syllable != other.Syllable || cr.Sandhi != other.Sandhi {
+		return false
+	}
+	if !cr.nucleus.Equal(other.nucleus) {
+		return false
+	}
+	if !cr.segments.Equal(other.segments) {
+		return false
+	}
 	return true
 }
 
@@ -95,43 +131,60 @@ func (cp *compiledPattern) Equal(other *compiledPattern) bool {
 // Compile compiles a rule into a set of regular expressions that can be used
 // to find matches
 func (r *Rule) Compile(categories CategoryList) (*CompiledRule, error) {
+	return r.compile(categories, settings{})
+}
+
+// compile compiles a rule using the given categories and settings
+func (r *Rule) compile(categories CategoryList, s settings) (*CompiledRule, error) {
 	var from, before, after, unBefore, unAfter *compiledPattern
 	var to string
 	var err error
+	var unnumbered map[string][]int
 	if r.From == "0" {
 		from, err = compilePattern("", categories)
 	} else {
-		from, err = compilePattern(r.From, categories)
+		from, unnumbered, err = compileCapturing(r.From, categories, replacedCategories(r.To))
 	}
 	if err != nil {
 		return nil, err
 	}
-	before, err = compilePattern(beforePattern(r.Before), categories)
+	if err = checkUnnumbered(r, unnumbered); err != nil {
+		return nil, err
+	}
+	boundary := s.boundary
+	if boundary == "" {
+		boundary = defaultBoundary
+	}
+	before, err = compilePattern(beforePattern(r.Before, boundary), categories)
 	if err != nil {
 		return nil, err
 	}
-	after, err = compilePattern(afterPattern(r.After), categories)
+	after, err = compilePattern(afterPattern(r.After, boundary), categories)
 	if err != nil {
 		return nil, err
 	}
 	if r.UnBefore != "" {
-		unBefore, err = compilePattern(beforePattern(r.UnBefore), categories)
+		unBefore, err = compilePattern(beforePattern(r.UnBefore, boundary), categories)
 		if err != nil {
 			return nil, err
 		}
 	}
 	if r.UnAfter != "" {
-		unAfter, err = compilePattern(afterPattern(r.UnAfter), categories)
+		unAfter, err = compilePattern(afterPattern(r.UnAfter, boundary), categories)
 		if err != nil {
 			return nil, err
 		}
 	}
+	bound, err := regexp.Compile(fmt.Sprintf("^(?:%s)$", boundary))
+	if err != nil {
+		return nil, err
+	}
 	if r.To == "0" {
 		to = ""
 	} else {
 		to = r.To
 	}
-	return &CompiledRule{
+	cr := &CompiledRule{
 		From:       from,
 		To:         to,
 		Before:     before,
@@ -139,42 +192,102 @@ func (r *Rule) Compile(categories CategoryList) (*CompiledRule, error) {
 		UnBefore:   unBefore,
 		UnAfter:    unAfter,
 		Categories: categories,
+		boundary:   bound,
+		segments:   s.segments,
+		unnumbered: unnumbered,
+		form:       s.form,
 		string:     r.String(),
-	}, nil
+	}
+	if err = cr.setModifiers(r.Modifiers); err != nil {
+		return nil, err
+	}
+	if cr.Syllable != 0 {
+		if s.nucleus == nil {
+			return nil, fmt.Errorf("modifier error: syllable position in `%s` requires a nucleus directive", r)
+		}
+		cr.nucleus = s.nucleus
+	}
+	return cr, nil
 }
 
 // CompileRule compiles a rule into a set of regular expressions that can be
 // used to find matches
 func (rl *RuleList) CompileRule(rule *Rule) (*CompiledRule, error) {
-	return rule.Compile(rl.Categories)
+	return rule.compile(rl.Categories, rl.settings)
 }
 
-// beforePattern formats a pattern for use in the Before or UnBefore of a rule
-func beforePattern(pattern string) string {
+// beforePattern formats a pattern for use in the Before or UnBefore of a rule,
+// where `#` matches the start of a word, that is, a run of boundary
+// characters, or the start of the string
+func beforePattern(pattern, boundary string) string {
+	wordStart := fmt.Sprintf(`(?:%s+|^)`, boundary)
 	pattern = strings.Replace(pattern, "#", wordStart, -1)
 	return fmt.Sprintf("(?:%s)$", pattern)
 }
 
-// afterPattern formats a pattern for use in the After or UnAfter of a rule
-func afterPattern(pattern string) string {
+// afterPattern formats a pattern for use in the After or UnAfter of a rule,
+// where `#` matches the end of a word, that is, a run of boundary characters,
+// or the end of the string
+func afterPattern(pattern, boundary string) string {
+	wordEnd := fmt.Sprintf(`(?:%s+|$)`, boundary)
 	pattern = strings.Replace(pattern, "#", wordEnd, -1)
 	return fmt.Sprintf("^(?:%s)", pattern)
 }
 
 // compilePattern generates a compiledPattern
 func compilePattern(pattern string, categories CategoryList) (*compiledPattern, error) {
+	cp, _, err := compileCapturing(pattern, categories, nil)
+	return cp, err
+}
+
+// compileCapturing generates a compiledPattern, in which the unnumbered
+// categories named in capture are captured as well as the numbered ones. It
+// also returns the numbers assigned to the occurrences of those categories
+func compileCapturing(pattern string, categories CategoryList, capture map[string]bool) (*compiledPattern, map[string][]int, error) {
 	// first, make all capturing groups non-capturing
 	pattern = parenMatcher.ReplaceAllStringFunc(pattern, parenReplacer)
 	// third, replace categories with regular expressions
-	pattern, nc, err := categories.categoryReplace(pattern)
+	pattern, nc, unnumbered, err := categories.categoryReplace(pattern, capture)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	re, err := regexp.Compile(pattern)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	return &compiledPattern{Regexp: re, nc: nc, categories: categories}, unnumbered, nil
+}
+
+// replacedCategories returns the set of names of the unnumbered categories in
+// the replacement text of a rule
+func replacedCategories(to string) map[string]bool {
+	var names map[string]bool
+	for _, groups := range replMatcher.FindAllStringSubmatch(to, -1) {
+		if groups[1] == "" {
+			if names == nil {
+				names = make(map[string]bool)
+			}
+			names[groups[2]] = true
+		}
 	}
-	return &compiledPattern{Regexp: re, nc: nc, categories: categories}, nil
+	return names
+}
+
+// checkUnnumbered checks that each unnumbered category in the replacement of
+// a rule refers to an occurrence of the same category in the match, given the
+// numbers assigned to those occurrences
+func checkUnnumbered(r *Rule, unnumbered map[string][]int) error {
+	count := make(map[string]int)
+	for _, groups := range replMatcher.FindAllStringSubmatch(r.To, -1) {
+		if groups[1] != "" {
+			continue
+		}
+		count[groups[2]]++
+		if count[groups[2]] > len(unnumbered[groups[2]]) {
+			return fmt.Errorf("parse error: unnumbered category %#v in the replacement of `%s` does not occur in the match", groups[2], r)
+		}
+	}
+	return nil
 }
 
 type numCat struct {
@@ -189,11 +302,14 @@ func (nc numCat) Equal(other numCat) bool {
 // categoryReplace replaces all categories in a pattern with regular
 // expressions that will match that category (and in the case of numbered
 // categories, capture it). It also returns a list of the numbers and
-// categories corresponding to each capturing group.
-func (cl CategoryList) categoryReplace(pattern string) (string, []numCat, error) {
+// categories corresponding to each capturing group. Unnumbered categories
+// whose names are in capture are also captured, and each of their occurrences
+// is assigned a distinct negative number, which are returned by name.
+func (cl CategoryList) categoryReplace(pattern string, capture map[string]bool) (string, []numCat, map[string][]int, error) {
 	var (
-		err error
-		nc  []numCat
+		err        error
+		nc         []numCat
+		unnumbered map[string][]int
 	)
 	replacer := func(match string) string {
 		if err != nil {
@@ -217,8 +333,18 @@ func (cl CategoryList) categoryReplace(pattern string) (string, []numCat, error)
 			nc = append(nc, numCat{num: n, cat: cat})
 			return fmt.Sprintf("(%s)", pat)
 		}
+		if capture[groups[2]] {
+			// unnumbered group which is referred to elsewhere
+			if unnumbered == nil {
+				unnumbered = make(map[string][]int)
+			}
+			n := -1 - len(nc)
+			unnumbered[groups[2]] = append(unnumbered[groups[2]], n)
+			nc = append(nc, numCat{num: n, cat: cat})
+			return fmt.Sprintf("(%s)", pat)
+		}
 		// non-capturing group
 		return fmt.Sprintf("(?:%s)", pat)
 	}
-	return catMatcher.ReplaceAllStringFunc(pattern, replacer), nc, err
+	return catMatcher.ReplaceAllStringFunc(pattern, replacer), nc, unnumbered, err
 }
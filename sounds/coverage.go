@@ -0,0 +1,168 @@
+package sounds
+
+import "fmt"
+
+// A RuleCoverage counts how many words of a lexicon a rule applied to
+type RuleCoverage struct {
+	File string `json:"file,omitempty"`
+	Line int    `json:"line"`
+	Rule string `json:"rule"`
+	// Matched is the number of words the rule matched, and Changed is the
+	// number it changed
+	Matched int `json:"matched"`
+	Changed int `json:"changed"`
+	// Undone is the number of words the rule changed, but which a later
+	// rule changed back to exactly the form they had before the rule
+	Undone int `json:"undone"`
+}
+
+// Dead reports whether the rule never matched
+func (rc RuleCoverage) Dead() bool {
+	return rc.Matched == 0
+}
+
+// AlwaysUndone reports whether the rule changed some words, but each change
+// was later undone
+func (rc RuleCoverage) AlwaysUndone() bool {
+	return rc.Changed > 0 && rc.Undone == rc.Changed
+}
+
+// A Coverage counts how many words of a lexicon each rule of a series of
+// RuleLists applied to
+type Coverage struct {
+	Words int            `json:"words"`
+	Rules []RuleCoverage `json:"rules"`
+	// index is the index in Rules of each rule, by its file and line
+	index map[ruleKey]int
+}
+
+// ruleKey identifies a rule by its file and line
+type ruleKey struct {
+	file string
+	line int
+}
+
+// NewCoverage initializes a Coverage of the rules in a series of RuleLists,
+// which have not applied to any words yet
+func NewCoverage(rls ...*RuleList) *Coverage {
+	cv := &Coverage{index: make(map[ruleKey]int)}
+	for _, rl := range rls {
+		for i, l := range rl.Lines {
+			if cr, ok := l.(*CompiledRule); ok {
+				key := ruleKey{rl.Filename, rl.lineNumber(i)}
+				if _, ok := cv.index[key]; ok {
+					continue
+				}
+				cv.index[key] = len(cv.Rules)
+				cv.Rules = append(cv.Rules, RuleCoverage{File: key.file, Line: key.line, Rule: cr.String()})
+			}
+		}
+	}
+	return cv
+}
+
+// Add counts the rules which applied to a word, given the trace of applying
+// the RuleLists to it. Rules which are not in the RuleLists are ignored
+func (cv *Coverage) Add(trace Trace) {
+	cv.Words++
+	// counts records whether each rule which matched the word changed
+	// it, and whether each of its changes was undone
+	type counts struct {
+		changed, undone bool
+	}
+	seen := make(map[int]*counts)
+	for i, st := range trace {
+		if st.Kind != StepRule || len(st.Matches) == 0 {
+			continue
+		}
+		k, ok := cv.index[ruleKey{st.File, st.Line}]
+		if !ok {
+			continue
+		}
+		c := seen[k]
+		if c == nil {
+			c = &counts{undone: true}
+			seen[k] = c
+		}
+		if !st.Changed() {
+			continue
+		}
+		c.changed = true
+		undone := false
+		// only a later rule can undo the change, not a file step or
+		// an orthography which happens to spell the word the same way
+		for _, later := range trace[i+1:] {
+			if later.Kind == StepRule && later.Output == st.Input {
+				undone = true
+				break
+			}
+		}
+		c.undone = c.undone && undone
+	}
+	for k, c := range seen {
+		rc := &cv.Rules[k]
+		rc.Matched++
+		if c.changed {
+			rc.Changed++
+			if c.undone {
+				rc.Undone++
+			}
+		}
+	}
+}
+
+// Dead returns the rules which never matched
+func (cv *Coverage) Dead() []RuleCoverage {
+	var out []RuleCoverage
+	for _, rc := range cv.Rules {
+		if rc.Dead() {
+			out = append(out, rc)
+		}
+	}
+	return out
+}
+
+// AlwaysUndone returns the rules which changed some words, but each change was
+// later undone
+func (cv *Coverage) AlwaysUndone() []RuleCoverage {
+	var out []RuleCoverage
+	for _, rc := range cv.Rules {
+		if rc.AlwaysUndone() {
+			out = append(out, rc)
+		}
+	}
+	return out
+}
+
+// Coverage applies the RuleList to each word of a lexicon, and counts how
+// many words each rule applied to
+func (rl *RuleList) Coverage(words []Word) (*Coverage, error) {
+	cv := NewCoverage(rl)
+	for _, w := range words {
+		_, trace, err := rl.ApplyWord(w)
+		if err != nil {
+			return nil, err
+		}
+		cv.Add(trace)
+	}
+	return cv, nil
+}
+
+// CoverageFiles applies a series of files to each word of a lexicon, as
+// described for ApplyChain, and counts how many words each rule applied
+// to
+func (c *Cache) CoverageFiles(words []Word, files ...string) (*Coverage, error) {
+	rls, err := c.LoadFiles(files...)
+	if err != nil {
+		return nil, err
+	}
+	cv := NewCoverage(rls...)
+	for _, w := range words {
+		res, err := c.ApplyChain(w, files...)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", w.Text, err)
+		}
+		cv.Add(res.Trace)
+	}
+	return cv, nil
+}
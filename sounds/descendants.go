@@ -0,0 +1,133 @@
+package sounds
+
+import "fmt"
+
+// A Reflex is the form a word takes in a descendant language
+type Reflex struct {
+	Node              *Node
+	Phonemic, Spelled Word
+	// Romanized is whether the spelled form was produced by a romanizer,
+	// rather than being the same as the phonemic form
+	Romanized bool
+}
+
+// descentState is the state of a word partway down a tree
+type descentState struct {
+	text Text
+	// persistent are the rules which persist through the chain so far
+	persistent []*CompiledRule
+	// last is the last RuleList applied, whose romanizer spells the word
+	last *RuleList
+	// deromanized is whether the first file below the root has been
+	// reached, so that no later file's deromanizer applies
+	deromanized bool
+}
+
+// ApplyDescendants applies the files of a tree to a word of the named
+// language, and returns its reflexes in every descendant of that language, in
+// the order the tree is drawn by Tree.ASCII. The reflex in each language is
+// the same as the result of applying the files leading down to it in turn, as
+// described for ApplyChain, but each file is only applied once, so the
+// files of a language shared by several descendants are not applied again for
+// each of them. As for ApplyRoute, the rules persisting through the chain in
+// the files from the root of the tree down to the named language are
+// re-applied in every descendant. It is an error if a descendant is missing,
+// as described for ScanTree
+func (c *Cache) ApplyDescendants(word Word, tree *Tree, root string) ([]Reflex, error) {
+	n, err := tree.Node(root)
+	if err != nil {
+		return nil, err
+	}
+	lineage, err := tree.lineage(root)
+	if err != nil {
+		return nil, err
+	}
+	rls, err := c.LoadFiles(nodeFiles(lineage)...)
+	if err != nil {
+		return nil, err
+	}
+	var inherited []*CompiledRule
+	for _, rl := range rls {
+		inherited = append(inherited, rl.chainPersistent()...)
+	}
+	text := singleWord(word.Text)
+	var patterns []CasePattern
+	if c.PreserveCase {
+		text, patterns = text.lowerCase()
+	}
+	var reflexes []Reflex
+	var descend func(n *Node, state descentState) error
+	descend = func(n *Node, state descentState) error {
+		for _, child := range n.Children {
+			if child.Missing {
+				return fmt.Errorf("tree error: %#v has no sound change file", child.Name)
+			}
+			next := state
+			if child.File != "" {
+				rl, err := c.LoadFile(child.File)
+				if err != nil {
+					return err
+				}
+				text := state.text
+				if !state.deromanized && rl.deromanizer != nil {
+					// this is the first file, so its deromanizer
+					// applies
+					text = rl.deromanizer.applyText(text)
+				}
+				text, _, err = rl.apply(text, word.Tags, state.persistent)
+				if err != nil {
+					return err
+				}
+				persistent := append([]*CompiledRule(nil), state.persistent...)
+				next = descentState{
+					text:        text,
+					persistent:  append(persistent, rl.chainPersistent()...),
+					last:        rl,
+					deromanized: true,
+				}
+			}
+			phonemic, spelled := next.text, next.text
+			romanized := next.last != nil && next.last.romanizer != nil
+			if romanized {
+				spelled = next.last.romanizer.applyText(next.text)
+			}
+			if patterns != nil {
+				phonemic = phonemic.restoreCase(patterns)
+				spelled = spelled.restoreCase(patterns)
+			}
+			reflexes = append(reflexes, Reflex{
+				Node:      child,
+				Phonemic:  Word{Text: phonemic.Words[0], Tags: word.Tags},
+				Spelled:   Word{Text: spelled.Words[0], Tags: word.Tags},
+				Romanized: romanized,
+			})
+			if err := descend(child, next); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := descend(n, descentState{text: text, persistent: inherited}); err != nil {
+		return nil, err
+	}
+	return reflexes, nil
+}
+
+// Descendants returns the descendants of the named node, in the order the tree
+// is drawn by Tree.ASCII
+func (t *Tree) Descendants(name string) ([]*Node, error) {
+	n, err := t.Node(name)
+	if err != nil {
+		return nil, err
+	}
+	var nodes []*Node
+	var descend func(n *Node)
+	descend = func(n *Node) {
+		for _, child := range n.Children {
+			nodes = append(nodes, child)
+			descend(child)
+		}
+	}
+	descend(n)
+	return nodes, nil
+}
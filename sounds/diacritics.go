@@ -0,0 +1,64 @@
+package sounds
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// replMatcher matches a category in replacement text, along with the
+// diacritic operations following it. Each operation is a `+` or `-` followed
+// by a run of combining marks or modifier letters
+var replMatcher = regexp.MustCompile(`\{(?:(\d+):)?(\p{L}[^}\s]*)\}((?:[+-][\p{M}\p{Lm}\p{Sk}]+)*)`)
+
+// opMatcher matches a single diacritic operation
+var opMatcher = regexp.MustCompile(`([+-])([\p{M}\p{Lm}\p{Sk}]+)`)
+
+// applyDiacritics applies a sequence of diacritic operations to a segment. A
+// `+` adds a diacritic, and a `-` removes it, so `-X+Y` swaps X for Y.
+// Combining marks are added after the base character and any combining marks
+// already on it, and modifier letters are added at the end. The segment is
+// decomposed to perform the operations, and the result is converted to the
+// given normalization form. If the form is nil, the result is decomposed if
+// the segment was, and precomposed otherwise, so that precomposed and
+// decomposed input are treated the same
+func applyDiacritics(segment, ops string, form *norm.Form) string {
+	if ops == "" {
+		return segment
+	}
+	if form == nil {
+		f := norm.NFC
+		if !norm.NFC.IsNormalString(segment) {
+			f = norm.NFD
+		}
+		form = &f
+	}
+	seg := norm.NFD.String(segment)
+	for _, op := range opMatcher.FindAllStringSubmatch(ops, -1) {
+		mark := norm.NFD.String(op[2])
+		switch op[1] {
+		case "+":
+			seg = addDiacritic(seg, mark)
+		case "-":
+			seg = strings.Replace(seg, mark, "", -1)
+		}
+	}
+	return form.String(seg)
+}
+
+// addDiacritic adds a diacritic to a decomposed segment
+func addDiacritic(seg, mark string) string {
+	r, _ := utf8.DecodeRuneInString(mark)
+	if !unicode.IsMark(r) {
+		// modifier letters go at the end
+		return seg + mark
+	}
+	// combining marks go before any trailing modifier letters
+	core := strings.TrimRightFunc(seg, func(r rune) bool {
+		return unicode.In(r, unicode.Lm, unicode.Sk)
+	})
+	return norm.NFD.String(core+mark) + seg[len(core):]
+}
@@ -0,0 +1,176 @@
+package sounds
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/zyxw59/conlang/transcription"
+	"golang.org/x/text/unicode/norm"
+)
+
+// A Directive is a line in a sound change file that begins with `@`, and
+// changes the settings used for the lines that follow it
+type Directive string
+
+func (d Directive) Apply(word string) (output, debug string, err error) {
+	return word, string(d), nil
+}
+
+// settings holds the state of a RuleList which is set by directives, and which
+// affects how later rules are compiled
+type settings struct {
+	// nucleus matches the nucleus of a syllable
+	nucleus *compiledPattern
+	// boundary matches a single character which separates words, and is
+	// used both to compile `#` in environments, and to decide which words
+	// of running text a rule is applied to together
+	boundary string
+	// segments is the segment inventory, which matches must not split
+	segments *Inventory
+	// form is the normalization form which lines and words are converted
+	// to, or nil if they are left as they are
+	form *norm.Form
+	// preserveCase is whether words are matched case-insensitively, and
+	// have their capitalization restored afterwards
+	preserveCase bool
+	// scheme is the transcription scheme which rules and categories are
+	// written in, or nil if they are written in the IPA
+	scheme *transcription.Scheme
+}
+
+// boundaryClasses are the named classes of characters which can be used in a
+// boundary directive
+var boundaryClasses = map[string]string{
+	"space":      `\s`,
+	"punct":      `[^\PP'’\-‐‑]`,
+	"hyphen":     `[\-‐‑]`,
+	"apostrophe": `['’]`,
+}
+
+// directives are the names of the available directives
+var directives = map[string]bool{
+	"nucleus": true, "boundary": true, "segments": true, "normalize": true,
+	"romanize": true, "deromanize": true, "romanize-file": true,
+	"deromanize-file": true, "transcription": true, "test": true,
+	"test-chain": true, "case": true,
+}
+
+// isDirective reports whether a line starts with `@` followed by the name of
+// a directive
+func isDirective(line string) bool {
+	name := strings.SplitN(strings.TrimPrefix(line, directivestr), " ", 2)[0]
+	return strings.HasPrefix(line, directivestr) && directives[name]
+}
+
+// parseDirective parses a line as a directive, and updates the settings of the
+// RuleList accordingly
+func (rl *RuleList) parseDirective(line string) error {
+	split := strings.SplitN(strings.TrimPrefix(line, directivestr), " ", 2)
+	name := split[0]
+	args := ""
+	if len(split) > 1 {
+		args = strings.TrimSpace(split[1])
+	}
+	switch name {
+	case "nucleus":
+		if args == "" {
+			return fmt.Errorf("directive error: `%s` requires a pattern", line)
+		}
+		nucleus, err := compilePattern(rl.transcribe(args), rl.Categories)
+		if err != nil {
+			return err
+		}
+		rl.settings.nucleus = nucleus
+	case "boundary":
+		boundary, err := parseBoundary(args)
+		if err != nil {
+			return err
+		}
+		rl.settings.boundary = boundary
+	case "segments":
+		rl.settings.segments = rl.parseInventory(args)
+	case "normalize":
+		return rl.parseNormalize(args)
+	case "romanize":
+		return rl.parseOrthography(&rl.romanizer, rl.transcribeEntry(args, true), false)
+	case "deromanize":
+		return rl.parseOrthography(&rl.deromanizer, rl.transcribeEntry(args, false), false)
+	case "romanize-file", "deromanize-file":
+		o := &rl.romanizer
+		if name == "deromanize-file" {
+			o = &rl.deromanizer
+		}
+		return rl.parseOrthography(o, args, true)
+	case "transcription":
+		return rl.parseTranscription(args)
+	case "test", "test-chain":
+		return rl.parseTest(args, name == "test-chain")
+	case "case":
+		switch args {
+		case "preserve":
+			rl.settings.preserveCase = true
+		case "exact":
+			rl.settings.preserveCase = false
+		default:
+			return fmt.Errorf("directive error: unknown case mode %#v", args)
+		}
+	default:
+		return fmt.Errorf("directive error: unknown directive `%s`", line)
+	}
+	return nil
+}
+
+// parseBoundary parses the arguments of a boundary directive, which is a
+// whitespace-separated list of names of classes of characters, or of literal
+// characters, and returns a regular expression which matches a single boundary
+// character
+func parseBoundary(args string) (string, error) {
+	var alts []string
+	for _, arg := range strings.Fields(args) {
+		if class, ok := boundaryClasses[arg]; ok {
+			alts = append(alts, class)
+			continue
+		}
+		for _, r := range arg {
+			alts = append(alts, regexp.QuoteMeta(string(r)))
+		}
+	}
+	switch len(alts) {
+	case 0:
+		return "", fmt.Errorf("directive error: boundary requires at least one character")
+	case 1:
+		return alts[0], nil
+	}
+	return fmt.Sprintf("(?:%s)", strings.Join(alts, "|")), nil
+}
+
+// parseInventory parses the arguments of a segments directive, which is a
+// whitespace-separated list of segments and categories. A category stands for
+// all of its elements. If there are no arguments, the inventory consists of
+// the elements of every category defined so far
+func (rl *RuleList) parseInventory(args string) *Inventory {
+	var segments []string
+	fields := strings.Fields(args)
+	if len(fields) == 0 {
+		for _, cat := range rl.Categories {
+			segments = append(segments, cat.values...)
+		}
+	}
+	for _, f := range fields {
+		if m := catMatcher.FindStringSubmatch(f); m != nil && m[0] == f {
+			if cat, ok := rl.Categories[m[2]]; ok {
+				segments = append(segments, cat.values...)
+				continue
+			}
+		}
+		segments = append(segments, rl.transcribe(f))
+	}
+	return NewInventory(segments)
+}
+
+// Inventory returns the segment inventory declared by the last segments
+// directive in the RuleList, or nil if there is none
+func (rl *RuleList) Inventory() *Inventory {
+	return rl.settings.segments
+}
@@ -3,8 +3,10 @@ package sounds
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"os"
 	"strings"
+	"unicode"
 )
 
 // LoadFile loads a sound change file as a RuleList
@@ -14,15 +16,28 @@ func LoadFile(filename string) (*RuleList, error) {
 	if err != nil {
 		return nil, err
 	}
+	return ReadRuleList(f, filename)
+}
+
+// ReadRuleList reads the contents of a sound change file as a RuleList. The
+// filename is used to name the RuleList, and to find files it refers to
+func ReadRuleList(r io.Reader, filename string) (*RuleList, error) {
+	return readRuleList(r, filename, "")
+}
+
+// readRuleList is like ReadRuleList, but the files the RuleList refers to are
+// read as they were at a git revision, unless it is empty
+func readRuleList(r io.Reader, filename, revision string) (*RuleList, error) {
 	rl := NewRuleList()
-	scanner := bufio.NewScanner(f)
+	rl.Filename, rl.revision = filename, revision
+	scanner := bufio.NewScanner(r)
 	for scanner.Scan() {
-		err = rl.ParseRuleCat(string(scanner.Text()))
+		err := rl.ParseRuleCat(string(scanner.Text()))
 		if err != nil {
 			return nil, err
 		}
 	}
-	if err = scanner.Err(); err != nil {
+	if err := scanner.Err(); err != nil {
 		return nil, err
 	}
 	return rl, nil
@@ -40,6 +55,19 @@ func stringSliceConcat(slices ...[]string) []string {
 	return out
 }
 
+// stringSliceEqual compares two slices of strings by value
+func stringSliceEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i, s := range a {
+		if s != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
 // Pairs takes a list of pairs of `.`-separated filenames, and returns the
 // intermediate steps between the start and end points. The second element of
 // each pair should be a relative path, starting with `.`
@@ -63,6 +91,59 @@ func Pairs(names ...string) (out []string, err error) {
 	return out, nil
 }
 
+// validName reports whether a string is a language name, made of `.`-separated
+// parts, each of which is a non-empty run of letters, digits, `-` and `_`
+func validName(name string) bool {
+	for _, part := range strings.Split(name, ".") {
+		if part == "" || strings.IndexFunc(part, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-' && r != '_'
+		}) >= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Route returns the route through the language tree from one name to another,
+// where the names are `.`-separated, as for Pairs, and the second name may be
+// relative to the first. To go from the first to the second, the files up
+// must be reversed, from last to first, to reach the closest common ancestor of
+// the two, and then the files down must be applied. So the route from
+// `latin.vulgar.french` to `latin.vulgar.iberian.spanish` goes up through
+// `latin.vulgar.french` to `latin.vulgar`, and down through
+// `latin.vulgar.iberian` and `latin.vulgar.iberian.spanish`. The files above
+// lead from the root down to the common ancestor, here `latin` and
+// `latin.vulgar`. An empty first name is the root of the tree, above every
+// other name
+func Route(from, to string) (above, up, down []string, err error) {
+	if strings.HasPrefix(to, ".") {
+		to = strings.TrimPrefix(from+to, ".")
+	}
+	for _, name := range []string{from, to} {
+		if name != "" && !validName(name) {
+			return nil, nil, nil, fmt.Errorf("route error: %#v is not a valid name", name)
+		}
+	}
+	fromSteps := splitAll(from, ".")
+	toSteps := splitAll(to, ".")
+	if from == "" {
+		fromSteps = nil
+	}
+	if to == "" {
+		toSteps = nil
+	}
+	// common is the number of steps shared by the two names
+	common := 0
+	for common < len(fromSteps) && common < len(toSteps) && fromSteps[common] == toSteps[common] {
+		common++
+	}
+	if common == 0 && len(fromSteps) > 0 && len(toSteps) > 0 {
+		return nil, nil, nil, fmt.Errorf("route error: %#v and %#v have no common ancestor "+
+			"(for a descendant of %#v, use %#v)", from, to, from, "."+to)
+	}
+	return fromSteps[:common], fromSteps[common:], toSteps[common:], nil
+}
+
 // splitAll splits a string by a separator, and returns a slice containing the
 // first element, the first and second elements, etc, upto the whole string.
 // So, for example, splitAll("a,b,c", ",") returns ["a", "a,b", "a,b,c"]
@@ -0,0 +1,99 @@
+package sounds
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// NewRevisionCache initializes a Cache which loads sound change files and
+// tree manifests as they were at a revision of the git repository containing
+// them, such as `HEAD~1` or a branch name, using the git command. Since the
+// files at a revision don't change, they are only loaded once. Orthography
+// files named by `@romanize-file` and `@deromanize-file` are also read at the
+// revision
+func NewRevisionCache(revision string) *Cache {
+	c := NewCache()
+	c.revision = revision
+	return c
+}
+
+// ParseRevisions parses the two git revisions of a comparison, given as
+// `old..new`, or as `old` to compare with the working tree, in which case the
+// new revision is empty. Since each side must be a single revision, the
+// symmetric difference `old...new` is an error
+func ParseRevisions(revisions string) (old, new string, err error) {
+	if strings.Contains(revisions, "...") {
+		return "", "", fmt.Errorf("git error: %#v is not a pair of revisions (use old..new)", revisions)
+	}
+	split := strings.SplitN(revisions, "..", 2)
+	if split[0] == "" {
+		return "", "", fmt.Errorf("git error: no old revision in %#v", revisions)
+	}
+	if len(split) > 1 {
+		new = split[1]
+	}
+	return split[0], new, nil
+}
+
+// gitShow returns the contents of a file as it was at a revision of the git
+// repository containing it. A revision starting with `-` is rejected, so that
+// it can't be read as an option
+func gitShow(revision, filename string) ([]byte, error) {
+	if strings.HasPrefix(revision, "-") {
+		return nil, fmt.Errorf("git error: invalid revision %#v", revision)
+	}
+	dir, base := filepath.Split(filename)
+	if dir == "" {
+		dir = "."
+	}
+	cmd := exec.Command("git", "-C", dir, "show", revision+":./"+base)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("git error: %s", msg)
+		}
+		return nil, fmt.Errorf("git error: %v", err)
+	}
+	return out, nil
+}
+
+// loadRevisionFile loads a sound change file as it was at the revision of the
+// Cache, and caches it
+func (c *Cache) loadRevisionFile(filename string) (*RuleList, error) {
+	if cf, ok := c.files[filename]; ok {
+		return cf.rl, nil
+	}
+	contents, err := gitShow(c.revision, filename)
+	if err != nil {
+		return nil, err
+	}
+	rl, err := readRuleList(bytes.NewReader(contents), filename, c.revision)
+	if err != nil {
+		return nil, err
+	}
+	c.files[filename] = cachedFile{name: filename, rl: rl}
+	return rl, nil
+}
+
+// loadRevisionTree loads a tree manifest file as it was at the revision of the
+// Cache, and caches it
+func (c *Cache) loadRevisionTree(filename string) (*Tree, error) {
+	if ct, ok := c.trees[filename]; ok {
+		return ct.tree, nil
+	}
+	contents, err := gitShow(c.revision, filename)
+	if err != nil {
+		return nil, err
+	}
+	t, err := ReadTree(bytes.NewReader(contents), filename)
+	if err != nil {
+		return nil, err
+	}
+	c.trees[filename] = cachedTree{tree: t}
+	return t, nil
+}
@@ -0,0 +1,238 @@
+package sounds
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// A GoldenStep is a rule which matched a word, and the form of the word after
+// it
+type GoldenStep struct {
+	Rule, Output string
+}
+
+// A GoldenEntry is the stored output of a word of a lexicon, along with the
+// rules which matched it on the way. In a golden file, each entry is a line
+// of tab-separated fields: the text of the word, its tags, separated by
+// spaces, its output, and the text and output of each rule
+type GoldenEntry struct {
+	Word   Word
+	Output string
+	Steps  []GoldenStep
+	// Trace is the trace of the rules applied to the word, if the entry was
+	// produced by applying them rather than read from a file
+	Trace Trace
+}
+
+// NewGoldenEntry returns the entry for a word, given its output and the trace
+// of the rules applied to it. Each time a rule matched the word is listed, in
+// order
+func NewGoldenEntry(word Word, output string, trace Trace) GoldenEntry {
+	e := GoldenEntry{Word: word, Output: output, Trace: trace}
+	for _, st := range trace.Fired() {
+		e.Steps = append(e.Steps, GoldenStep{Rule: st.Text, Output: st.Output})
+	}
+	return e
+}
+
+// String writes the entry as a line of a golden file
+func (e GoldenEntry) String() string {
+	fields := []string{e.Word.Text, e.Word.Tags.String(), e.Output}
+	for _, s := range e.Steps {
+		fields = append(fields, s.Rule, s.Output)
+	}
+	return strings.Join(fields, "\t")
+}
+
+// key identifies the word of the entry in a lexicon
+func (e GoldenEntry) key() string {
+	return e.Word.String()
+}
+
+// ParseGoldenEntry parses a line of a golden file
+func ParseGoldenEntry(line string) (GoldenEntry, error) {
+	fields := strings.Split(line, "\t")
+	if len(fields) < 3 || len(fields)%2 == 0 {
+		return GoldenEntry{}, fmt.Errorf("golden error: `%s` is not a valid entry", line)
+	}
+	e := GoldenEntry{Word: Word{Text: fields[0]}, Output: fields[2]}
+	if tags := strings.Fields(fields[1]); len(tags) > 0 {
+		e.Word.Tags = NewTags(tags...)
+	}
+	for i := 3; i < len(fields); i += 2 {
+		e.Steps = append(e.Steps, GoldenStep{Rule: fields[i], Output: fields[i+1]})
+	}
+	return e, nil
+}
+
+// ReadGolden reads the entries of a golden file. Blank lines are skipped
+func ReadGolden(r io.Reader) ([]GoldenEntry, error) {
+	var entries []GoldenEntry
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		e, err := ParseGoldenEntry(scanner.Text())
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// LoadGolden reads the entries of a golden file, or returns no entries if the
+// file does not exist yet
+func LoadGolden(filename string) ([]GoldenEntry, error) {
+	f, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadGolden(f)
+}
+
+// WriteGolden writes a list of entries as a golden file
+func WriteGolden(w io.Writer, entries []GoldenEntry) error {
+	bw := bufio.NewWriter(w)
+	for _, e := range entries {
+		if _, err := fmt.Fprintln(bw, e); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// SaveGolden writes a list of entries to a golden file, replacing it
+func SaveGolden(filename string, entries []GoldenEntry) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err = WriteGolden(f, entries); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// GoldenFiles applies a series of files to each word of a lexicon, as
+// described for ApplyChain, and returns the entries for a golden file, with
+// the spelled form of each output
+func (c *Cache) GoldenFiles(words []Word, files ...string) ([]GoldenEntry, error) {
+	entries := make([]GoldenEntry, len(words))
+	for i, w := range words {
+		res, err := c.ApplyChain(w, files...)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", w.Text, err)
+		}
+		entries[i] = NewGoldenEntry(w, res.Spelled.Text, res.Trace)
+	}
+	return entries, nil
+}
+
+// A DiffKind is the way a word differs between two versions of a lexicon
+type DiffKind string
+
+// The kinds of differences
+const (
+	DiffAdded   DiffKind = "added"
+	DiffRemoved DiffKind = "removed"
+	DiffChanged DiffKind = "changed"
+)
+
+// A GoldenDiff is a word whose output differs between two lists of entries
+type GoldenDiff struct {
+	Kind DiffKind
+	// Old and New are the entries for the word. Old is empty for an added
+	// word, and New for a removed one
+	Old, New GoldenEntry
+	// Gained and Lost are the rules which the new and old outputs of the
+	// word diverge on, as described for divergence. Gained are steps of the
+	// new trace. They are only set for changed words
+	Gained Trace
+	Lost   []GoldenStep
+}
+
+// CompareGolden compares the old entries for a lexicon with the new ones, and
+// returns the words which were added, removed or whose output changed, in the
+// order of the new entries, followed by the removed words. If a word appears
+// more than once, only its first entry is compared
+func CompareGolden(old, new []GoldenEntry) []GoldenDiff {
+	oldEntries := make(map[string]GoldenEntry, len(old))
+	for _, e := range old {
+		if _, ok := oldEntries[e.key()]; !ok {
+			oldEntries[e.key()] = e
+		}
+	}
+	var diffs []GoldenDiff
+	seen := make(map[string]bool, len(new))
+	for _, e := range new {
+		if seen[e.key()] {
+			continue
+		}
+		seen[e.key()] = true
+		o, ok := oldEntries[e.key()]
+		switch {
+		case !ok:
+			diffs = append(diffs, GoldenDiff{Kind: DiffAdded, New: e})
+		case o.Output != e.Output:
+			d := GoldenDiff{Kind: DiffChanged, Old: o, New: e}
+			d.Gained, d.Lost = divergence(o.Steps, e.Trace.Fired())
+			diffs = append(diffs, d)
+		}
+	}
+	for _, e := range old {
+		if !seen[e.key()] {
+			seen[e.key()] = true
+			diffs = append(diffs, GoldenDiff{Kind: DiffRemoved, Old: e})
+		}
+	}
+	return diffs
+}
+
+// divergence compares the rules which matched a word before and after a
+// change, given as the old steps and the new trace. The first rule whose
+// output differs, or which only matched on one side, is where the two diverge,
+// and is both gained and lost if it matched on both sides. It is followed by
+// the later rules which only matched on one side, each listed once. So an edit
+// to a category is blamed on the first rule whose output it changed
+func divergence(old []GoldenStep, new Trace) (gained Trace, lost []GoldenStep) {
+	i := 0
+	for i < len(old) && i < len(new) && old[i] == (GoldenStep{Rule: new[i].Text, Output: new[i].Output}) {
+		i++
+	}
+	oldRules := make(map[string]bool, len(old))
+	for _, s := range old {
+		oldRules[s.Rule] = true
+	}
+	newRules := make(map[string]bool, len(new))
+	for _, st := range new {
+		newRules[st.Text] = true
+	}
+	seen := make(map[string]bool)
+	for j, st := range new[i:] {
+		if (j == 0 || !oldRules[st.Text]) && !seen[st.Text] {
+			seen[st.Text] = true
+			gained = append(gained, st)
+		}
+	}
+	seen = make(map[string]bool)
+	for j, s := range old[i:] {
+		if (j == 0 || !newRules[s.Rule]) && !seen[s.Rule] {
+			seen[s.Rule] = true
+			lost = append(lost, s)
+		}
+	}
+	return gained, lost
+}
@@ -0,0 +1,310 @@
+package sounds
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// An InteractionKind is the way in which the order of two rules matters
+type InteractionKind string
+
+// The kinds of interactions between an earlier rule and a later rule
+const (
+	// Feeding is where the earlier rule creates the environment of the
+	// later rule
+	Feeding InteractionKind = "feeds"
+	// Bleeding is where the earlier rule destroys the environment of the
+	// later rule
+	Bleeding InteractionKind = "bleeds"
+	// Counterfeeding is where the later rule would create the environment
+	// of the earlier rule, if it came first
+	Counterfeeding InteractionKind = "counterfeeds"
+	// Counterbleeding is where the later rule would destroy the
+	// environment of the earlier rule, if it came first
+	Counterbleeding InteractionKind = "counterbleeds"
+)
+
+// A RuleRef identifies a rule of a sound change file
+type RuleRef struct {
+	File string `json:"file,omitempty"`
+	Line int    `json:"line"`
+	Rule string `json:"rule"`
+}
+
+// String writes the reference as `file:line  rule`
+func (r RuleRef) String() string {
+	return fmt.Sprintf("%s  %s", r.position(), r.Rule)
+}
+
+// position writes the file and line of the rule as `file:line`
+func (r RuleRef) position() string {
+	return fmt.Sprintf("%s:%d", r.File, r.Line)
+}
+
+// An InteractionExample is a word whose derivation shows an interaction,
+// with its output in the order the rules are given, and with the two rules
+// swapped
+type InteractionExample struct {
+	Word    Word   `json:"word"`
+	Output  string `json:"output"`
+	Swapped string `json:"swapped"`
+}
+
+// An Interaction is a way in which the order of two rules of the same file
+// matters for some words of a lexicon
+type Interaction struct {
+	Kind InteractionKind `json:"kind"`
+	// First is the rule which comes first in the file, and Second is the
+	// rule which comes after it
+	First  RuleRef `json:"first"`
+	Second RuleRef `json:"second"`
+	// Count is the number of words which show the interaction, and
+	// Examples are some of them
+	Count    int                  `json:"count"`
+	Examples []InteractionExample `json:"examples"`
+}
+
+// Direction returns the rule which does the feeding or bleeding, followed by
+// the rule which is fed or bled. For counterfeeding and counterbleeding, this
+// is the later rule followed by the earlier one
+func (i Interaction) Direction() (from, to RuleRef) {
+	if i.Kind == Counterfeeding || i.Kind == Counterbleeding {
+		return i.Second, i.First
+	}
+	return i.First, i.Second
+}
+
+// interactionKey identifies an interaction by its kind and rules
+type interactionKey struct {
+	kind          InteractionKind
+	first, second ruleKey
+}
+
+// Interactions collects the ways in which the order of the rules of a series
+// of RuleLists matters for the words of a lexicon
+type Interactions struct {
+	Words int `json:"words"`
+	rls   []*RuleList
+	found map[interactionKey]*Interaction
+	// examples is the number of examples kept of each interaction
+	examples int
+}
+
+// NewInteractions initializes a collection of the interactions between the
+// rules of each of a series of RuleLists, which keeps at most the given
+// number of examples of each interaction
+func NewInteractions(examples int, rls ...*RuleList) *Interactions {
+	return &Interactions{rls: rls, found: make(map[interactionKey]*Interaction), examples: examples}
+}
+
+// add records an interaction shown by a word
+func (in *Interactions) add(kind InteractionKind, first, second RuleRef, ex InteractionExample) {
+	key := interactionKey{kind, ruleKey{first.File, first.Line}, ruleKey{second.File, second.Line}}
+	i, ok := in.found[key]
+	if !ok {
+		i = &Interaction{Kind: kind, First: first, Second: second}
+		in.found[key] = i
+	}
+	i.Count++
+	if len(i.Examples) < in.examples {
+		i.Examples = append(i.Examples, ex)
+	}
+}
+
+// Add finds the interactions shown by a word, given the trace of applying the
+// RuleLists to it, from which the form of the word at the start of each
+// RuleList is taken
+func (in *Interactions) Add(word Word, trace Trace) error {
+	in.Words++
+	var persistent []*CompiledRule
+	i := 0
+	for _, st := range trace {
+		if st.Kind != StepFile || i >= len(in.rls) {
+			continue
+		}
+		rl := in.rls[i]
+		if err := rl.interactions(word, singleWord(st.Input), persistent, in); err != nil {
+			return err
+		}
+		persistent = append(persistent, rl.chainPersistent()...)
+		i++
+	}
+	return nil
+}
+
+// List returns the interactions, sorted by file and by the lines of their
+// rules
+func (in *Interactions) List() []Interaction {
+	out := make([]Interaction, 0, len(in.found))
+	for _, i := range in.found {
+		out = append(out, *i)
+	}
+	sort.Slice(out, func(a, b int) bool {
+		x, y := out[a], out[b]
+		switch {
+		case x.First.File != y.First.File:
+			return x.First.File < y.First.File
+		case x.First.Line != y.First.Line:
+			return x.First.Line < y.First.Line
+		case x.Second.Line != y.Second.Line:
+			return x.Second.Line < y.Second.Line
+		}
+		return x.Kind < y.Kind
+	})
+	return out
+}
+
+// swapped returns a copy of the RuleList with two of its lines exchanged
+func (rl *RuleList) swapped(i, j int) *RuleList {
+	out := *rl
+	out.Lines = append([]Applier(nil), rl.Lines...)
+	out.Lines[i], out.Lines[j] = out.Lines[j], out.Lines[i]
+	out.lineNumbers = make([]int, len(rl.Lines))
+	for k := range rl.Lines {
+		out.lineNumbers[k] = rl.lineNumber(k)
+	}
+	out.lineNumbers[i], out.lineNumbers[j] = out.lineNumbers[j], out.lineNumbers[i]
+	return &out
+}
+
+// ruleMatched reports whether a rule matched the text anywhere in a trace, and
+// whether it changed it. Persistent rules of earlier files are told apart from
+// the rule by their file
+func ruleMatched(trace Trace, r RuleRef) (matched, changed bool) {
+	for _, st := range trace {
+		if st.Kind == StepRule && st.File == r.File && st.Line == r.Line && len(st.Matches) > 0 {
+			matched = true
+			changed = changed || st.Changed()
+		}
+	}
+	return matched, changed
+}
+
+// interactions finds the interactions between each pair of rules of the
+// RuleList shown by the derivation of a word, by applying the RuleList with
+// the two rules swapped. Only pairs in which one of the rules changes the word
+// when they are in their given order are considered. An earlier rule feeds a
+// later rule if the later one only matches when it comes second, and bleeds it
+// if the later one only matches when it comes first. A later rule
+// counterfeeds an earlier one if the earlier one only matches when it comes
+// second, and the output differs, and counterbleeds it if the earlier one only
+// matches when it comes first, and the output differs.
+//
+// This is a heuristic: swapping two rules which are not adjacent also moves
+// each of them past the rules in between, so an interaction with one of those
+// rules can be reported as one between the pair. It is also costly, since the
+// RuleList is applied again for each pair, which for R rules is up to R²/2
+// times per word
+func (rl *RuleList) interactions(word Word, text Text, inherited []*CompiledRule, in *Interactions) error {
+	output, trace, err := rl.apply(text, word.Tags, inherited)
+	if err != nil {
+		return err
+	}
+	var rules []int
+	for i, l := range rl.Lines {
+		if _, ok := l.(*CompiledRule); ok {
+			rules = append(rules, i)
+		}
+	}
+	for a, i := range rules {
+		first := RuleRef{File: rl.Filename, Line: rl.lineNumber(i), Rule: rl.Lines[i].(*CompiledRule).String()}
+		firstMatched, firstChanged := ruleMatched(trace, first)
+		for _, j := range rules[a+1:] {
+			second := RuleRef{File: rl.Filename, Line: rl.lineNumber(j), Rule: rl.Lines[j].(*CompiledRule).String()}
+			secondMatched, secondChanged := ruleMatched(trace, second)
+			if !firstChanged && !secondChanged {
+				continue
+			}
+			swapped, swappedTrace, err := rl.swapped(i, j).apply(text, word.Tags, inherited)
+			if err != nil {
+				return err
+			}
+			ex := InteractionExample{Word: word, Output: output.String(), Swapped: swapped.String()}
+			firstMatchedSwapped, _ := ruleMatched(swappedTrace, first)
+			secondMatchedSwapped, _ := ruleMatched(swappedTrace, second)
+			switch {
+			case firstChanged && secondMatched && !secondMatchedSwapped:
+				in.add(Feeding, first, second, ex)
+			case firstChanged && !secondMatched && secondMatchedSwapped:
+				in.add(Bleeding, first, second, ex)
+			}
+			if ex.Output == ex.Swapped {
+				continue
+			}
+			switch {
+			case !firstMatched && firstMatchedSwapped && secondChanged:
+				in.add(Counterfeeding, first, second, ex)
+			case firstMatched && !firstMatchedSwapped && secondChanged:
+				in.add(Counterbleeding, first, second, ex)
+			}
+		}
+	}
+	return nil
+}
+
+// Interactions finds the ways in which the order of each pair of rules of the
+// RuleList matters for the words of a lexicon, as described for the kinds of
+// interactions, keeping at most the given number of examples of each
+func (rl *RuleList) Interactions(words []Word, examples int) (*Interactions, error) {
+	in := NewInteractions(examples, rl)
+	for _, w := range words {
+		in.Words++
+		if err := rl.interactions(w, singleWord(w.Text), nil, in); err != nil {
+			return nil, err
+		}
+	}
+	return in, nil
+}
+
+// InteractionsFiles finds the interactions between the rules of each of a
+// series of files, as described for RuleList.Interactions. Each file is
+// given the form of each word after the files before it, as described for
+// ApplyChain
+func (c *Cache) InteractionsFiles(words []Word, examples int, files ...string) (*Interactions, error) {
+	rls, err := c.LoadFiles(files...)
+	if err != nil {
+		return nil, err
+	}
+	in := NewInteractions(examples, rls...)
+	for _, w := range words {
+		res, err := c.ApplyChain(w, files...)
+		if err == nil {
+			err = in.Add(w, res.Trace)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", w.Text, err)
+		}
+	}
+	return in, nil
+}
+
+// DOT writes the interactions as a graph in the DOT language of Graphviz, with
+// a node for each rule, and an edge from each rule to each rule it interacts
+// with, labelled with the kind of interaction and the number of words which
+// show it. Counterfeeding and counterbleeding edges go from the later rule to
+// the earlier one, and are dashed
+func (in *Interactions) DOT() string {
+	var b strings.Builder
+	b.WriteString("digraph interactions {\n")
+	seen := make(map[RuleRef]bool)
+	node := func(r RuleRef) {
+		if !seen[r] {
+			seen[r] = true
+			fmt.Fprintf(&b, "\t%q [label=%q];\n", r.position(), r.Rule)
+		}
+	}
+	for _, i := range in.List() {
+		node(i.First)
+		node(i.Second)
+		from, to := i.Direction()
+		style := ""
+		if from != i.First {
+			style = " style=dashed"
+		}
+		label := fmt.Sprintf("%s (%d)", i.Kind, i.Count)
+		fmt.Fprintf(&b, "\t%q -> %q [label=%q%s];\n", from.position(), to.position(), label, style)
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
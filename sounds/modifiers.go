@@ -0,0 +1,113 @@
+package sounds
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Persistence describes whether, and for how long, a rule is re-applied after
+// the lines that follow it
+type Persistence int
+
+const (
+	// NotPersistent rules are applied once, in order
+	NotPersistent Persistence = iota
+	// PersistFile rules are re-applied after every later line of the
+	// file that changes the word
+	PersistFile
+	// PersistChain rules are re-applied like PersistFile rules, and also
+	// after every line of the files that follow in a chain
+	PersistChain
+)
+
+// setModifiers parses a whitespace-separated list of rule modifiers, and sets
+// the corresponding fields of the rule. Each modifier is either a tag
+// condition, which is a tag prefixed by `+` or `-`, a bare name, or a name and
+// a value separated by `=`
+func (cr *CompiledRule) setModifiers(mods string) error {
+	for _, mod := range strings.Fields(mods) {
+		switch {
+		case strings.HasPrefix(mod, "+") && len(mod) > 1:
+			cr.Require = append(cr.Require, mod[1:])
+			continue
+		case strings.HasPrefix(mod, "-") && len(mod) > 1:
+			cr.Forbid = append(cr.Forbid, mod[1:])
+			continue
+		}
+		name, value := mod, ""
+		if i := strings.Index(mod, "="); i >= 0 {
+			name, value = mod[:i], mod[i+1:]
+		}
+		switch name {
+		case "persist":
+			switch value {
+			case "", "file":
+				cr.Persist = PersistFile
+			case "chain":
+				cr.Persist = PersistChain
+			default:
+				return fmt.Errorf("modifier error: invalid persistence %#v", value)
+			}
+		case "sandhi":
+			if value != "" {
+				return fmt.Errorf("modifier error: %#v does not take a value", name)
+			}
+			cr.Sandhi = true
+		case "first", "last":
+			if value != "" {
+				return fmt.Errorf("modifier error: %#v does not take a value", name)
+			}
+			cr.Nth, _ = parseOrdinal(name)
+		case "nth":
+			n, err := parseOrdinal(value)
+			if err != nil {
+				return err
+			}
+			cr.Nth = n
+		case "syllable":
+			n, err := parseOrdinal(value)
+			if err != nil {
+				return err
+			}
+			cr.Syllable = n
+		default:
+			return fmt.Errorf("modifier error: unknown modifier %#v", mod)
+		}
+	}
+	return nil
+}
+
+// parseOrdinal parses the value of a positional modifier. Positive numbers
+// count from the start, starting at 1, and negative numbers count from the
+// end, starting at -1. `first` and `last` are synonyms for 1 and -1
+func parseOrdinal(value string) (int, error) {
+	switch value {
+	case "first":
+		return 1, nil
+	case "last":
+		return -1, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n == 0 {
+		return 0, fmt.Errorf("modifier error: invalid position %#v", value)
+	}
+	return n, nil
+}
+
+// AppliesTo reports whether a word with the given tags meets the tag
+// conditions of the rule, that is, whether it has all the tags the rule
+// requires, and none of the tags the rule forbids
+func (cr *CompiledRule) AppliesTo(tags Tags) bool {
+	for _, tag := range cr.Require {
+		if !tags.Has(tag) {
+			return false
+		}
+	}
+	for _, tag := range cr.Forbid {
+		if tags.Has(tag) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,80 @@
+package sounds
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// ParseForm parses the name of a Unicode normalization form, which is one of
+// `nfc`, `nfd`, `nfkc` or `nfkd`, ignoring case
+func ParseForm(name string) (norm.Form, error) {
+	switch strings.ToLower(name) {
+	case "nfc":
+		return norm.NFC, nil
+	case "nfd":
+		return norm.NFD, nil
+	case "nfkc":
+		return norm.NFKC, nil
+	case "nfkd":
+		return norm.NFKD, nil
+	}
+	return 0, fmt.Errorf("normalization error: unknown form %#v", name)
+}
+
+// Normalize converts a word into the normalization form declared by the
+// RuleList, or returns it unchanged if the RuleList has no normalize
+// directive
+func (rl *RuleList) Normalize(word string) string {
+	return rl.settings.normalize(word)
+}
+
+// normalize converts a string into the normalization form of the settings, if
+// there is one
+func (s settings) normalize(str string) string {
+	if s.form == nil {
+		return str
+	}
+	return s.form.String(str)
+}
+
+// parseNormalize parses the arguments of a normalize directive. It must come
+// before any rules or categories, so that they are all normalized in the same
+// way
+func (rl *RuleList) parseNormalize(args string) error {
+	if len(rl.Categories) > 0 {
+		return fmt.Errorf("directive error: normalize must come before any categories")
+	}
+	for _, l := range rl.Lines {
+		if _, ok := l.(*CompiledRule); ok {
+			return fmt.Errorf("directive error: normalize must come before any rules")
+		}
+	}
+	if strings.ToLower(args) == "none" {
+		rl.settings.form = nil
+		return nil
+	}
+	form, err := ParseForm(args)
+	if err != nil {
+		return err
+	}
+	rl.settings.form = &form
+	return nil
+}
+
+// normalizeText normalizes each word and separator in a text
+func (rl *RuleList) normalizeText(text Text) Text {
+	if rl.settings.form == nil {
+		return text
+	}
+	words := make([]string, len(text.Words))
+	for i, w := range text.Words {
+		words[i] = rl.Normalize(w)
+	}
+	seps := make([]string, len(text.Seps))
+	for i, s := range text.Seps {
+		seps[i] = rl.Normalize(s)
+	}
+	return Text{Words: words, Seps: seps}
+}
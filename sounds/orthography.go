@@ -0,0 +1,205 @@
+package sounds
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// An Orthography is an ordered table of transliterations, used to convert
+// words between a spelling and a phonemic form. At each point in a word, the
+// longest entry which matches, and whose context matches, is used, with ties
+// going to the entry which was added first. Characters which no entry matches
+// are left as they are
+type Orthography struct {
+	entries []orthEntry
+}
+
+// an orthEntry is a single entry in an Orthography
+type orthEntry struct {
+	from, to                         string
+	before, after, unBefore, unAfter *compiledPattern
+	string
+}
+
+// Add parses a line of the form `from > to`, optionally followed by an
+// environment and a negative environment, as in a rule, and adds it to the
+// table. The environments may use the given categories
+func (o *Orthography) Add(line string, categories CategoryList) error {
+	r, err := ParseRule(line)
+	if err != nil {
+		return err
+	}
+	if r.From == "" || r.From == "0" {
+		return fmt.Errorf("orthography error: `%s` does not transliterate anything", line)
+	}
+	if r.Modifiers != "" {
+		return fmt.Errorf("orthography error: `%s` has modifiers", line)
+	}
+	e := orthEntry{from: r.From, to: r.To, string: r.String()}
+	if e.to == "0" {
+		e.to = ""
+	}
+	if e.before, err = compilePattern(beforePattern(r.Before, defaultBoundary), categories); err != nil {
+		return err
+	}
+	if e.after, err = compilePattern(afterPattern(r.After, defaultBoundary), categories); err != nil {
+		return err
+	}
+	if r.UnBefore != "" {
+		if e.unBefore, err = compilePattern(beforePattern(r.UnBefore, defaultBoundary), categories); err != nil {
+			return err
+		}
+	}
+	if r.UnAfter != "" {
+		if e.unAfter, err = compilePattern(afterPattern(r.UnAfter, defaultBoundary), categories); err != nil {
+			return err
+		}
+	}
+	o.entries = append(o.entries, e)
+	return nil
+}
+
+// Len returns the number of entries in the table
+func (o *Orthography) Len() int {
+	return len(o.entries)
+}
+
+// Apply transliterates a word. Contexts are matched against the original
+// word, not the output
+func (o *Orthography) Apply(word string) string {
+	var out strings.Builder
+	for i := 0; i < len(word); {
+		var best *orthEntry
+		for j := range o.entries {
+			e := &o.entries[j]
+			if best != nil && len(e.from) <= len(best.from) {
+				continue
+			}
+			if e.matches(word, i) {
+				best = e
+			}
+		}
+		if best == nil {
+			_, n := utf8.DecodeRuneInString(word[i:])
+			out.WriteString(word[i : i+n])
+			i += n
+			continue
+		}
+		out.WriteString(best.to)
+		i += len(best.from)
+	}
+	return out.String()
+}
+
+// matches reports whether an entry matches a word at a given position
+func (e *orthEntry) matches(word string, pos int) bool {
+	if !strings.HasPrefix(word[pos:], e.from) {
+		return false
+	}
+	end := pos + len(e.from)
+	if !e.before.MatchString(word[:pos]) || !e.after.MatchString(word[end:]) {
+		return false
+	}
+	if e.unBefore != nil && e.unBefore.MatchString(word[:pos]) {
+		return false
+	}
+	if e.unAfter != nil && e.unAfter.MatchString(word[end:]) {
+		return false
+	}
+	return true
+}
+
+// applyText transliterates each word of a text
+func (o *Orthography) applyText(text Text) Text {
+	words := make([]string, len(text.Words))
+	for i, w := range text.Words {
+		words[i] = o.Apply(w)
+	}
+	return text.withWords(words)
+}
+
+// LoadOrthography loads a standalone orthography file, in which each line is
+// an entry, as described for Orthography.Add, a comment, or blank
+func LoadOrthography(filename string) (*Orthography, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadOrthography(f)
+}
+
+// ReadOrthography reads the contents of a standalone orthography file, as
+// described for LoadOrthography
+func ReadOrthography(r io.Reader) (*Orthography, error) {
+	o := &Orthography{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, commentstr) {
+			continue
+		}
+		if err := o.Add(line, nil); err != nil {
+			return nil, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// parseOrthography parses the arguments of a romanize or deromanize directive,
+// which is either an entry to add to the table, or, if the directive name
+// ends in `-file`, the name of a standalone orthography file. Relative file
+// names are relative to the directory of the sound change file. If the
+// RuleList was read at a git revision, so is the orthography file
+func (rl *RuleList) parseOrthography(o **Orthography, args string, file bool) error {
+	if file {
+		filename := args
+		if !filepath.IsAbs(filename) && rl.Filename != "" {
+			filename = filepath.Join(filepath.Dir(rl.Filename), filename)
+		}
+		var loaded *Orthography
+		var err error
+		if rl.revision != "" {
+			var contents []byte
+			if contents, err = gitShow(rl.revision, filename); err == nil {
+				loaded, err = ReadOrthography(bytes.NewReader(contents))
+			}
+		} else {
+			loaded, err = LoadOrthography(filename)
+		}
+		if err != nil {
+			return err
+		}
+		if *o == nil {
+			*o = loaded
+		} else {
+			(*o).entries = append((*o).entries, loaded.entries...)
+		}
+		return nil
+	}
+	if *o == nil {
+		*o = &Orthography{}
+	}
+	return (*o).Add(args, rl.Categories)
+}
+
+// Romanizer returns the table used to spell the output of the RuleList, or nil
+// if it has none
+func (rl *RuleList) Romanizer() *Orthography {
+	return rl.romanizer
+}
+
+// Deromanizer returns the table used to convert spelled input to the phonemic
+// form expected by the RuleList, or nil if it has none
+func (rl *RuleList) Deromanizer() *Orthography {
+	return rl.deromanizer
+}
@@ -7,15 +7,18 @@ import (
 )
 
 const (
-	commentstr = "//"
-	arrowstr   = " > "
-	equalstr   = " = "
-	ruleFromTo = `(\S*) > (\S*)`
-	ruleEnv    = `(?: \/ ([^\s_]*)_([^\s_]*))?`
-	ruleUnEnv  = `(?: ! ([^\s_]*)_([^\s_]*))?`
+	commentstr   = "//"
+	directivestr = "@"
+	arrowstr     = " > "
+	equalstr     = " = "
+	teststr      = "=>"
+	ruleFromTo   = `(\S*) > (\S*)`
+	ruleEnv      = `(?: \/ ([^\s_]*)_([^\s_]*))?`
+	ruleUnEnv    = `(?: ! ([^\s_]*)_([^\s_]*))?`
+	ruleMods     = `(?: ; (.*))?`
 )
 
-var ruleRegExp = regexp.MustCompile(`^` + ruleFromTo + ruleEnv + ruleUnEnv + `$`)
+var ruleRegExp = regexp.MustCompile(`^` + ruleFromTo + ruleEnv + ruleUnEnv + ruleMods + `$`)
 
 type Applier interface {
 	// Apply applies a sound change to a word, or makes no change, and
@@ -29,6 +32,21 @@ type Applier interface {
 type RuleList struct {
 	Categories CategoryList
 	Lines      []Applier
+	// Filename is the name of the file the RuleList was loaded from, if
+	// any
+	Filename string
+	// revision is the git revision the files the RuleList refers to are
+	// read at, or the empty string for the working tree
+	revision string
+	// lineNumbers are the line numbers of the Lines in the file, and
+	// lineCount is the number of lines parsed so far, including blank
+	// lines
+	lineNumbers []int
+	lineCount   int
+	settings    settings
+	tests       []TestCase
+	romanizer   *Orthography
+	deromanizer *Orthography
 }
 
 // NewRuleList initializes an empty RuleList
@@ -37,14 +55,16 @@ func NewRuleList() *RuleList {
 }
 
 // A Rule is a sound change rule that changes a sound or set of sounds to
-// another, in a given environment
+// another, in a given environment. Modifiers is a whitespace-separated list of
+// modifiers which alter how the rule is applied
 type Rule struct {
-	From     string
-	To       string
-	Before   string
-	After    string
-	UnBefore string
-	UnAfter  string
+	From      string
+	To        string
+	Before    string
+	After     string
+	UnBefore  string
+	UnAfter   string
+	Modifiers string
 }
 
 // Equal compares two Rules by value
@@ -54,7 +74,7 @@ func (r *Rule) Equal(other *Rule) bool {
 
 // String writes the rule as it would appear in a sound change file
 func (r *Rule) String() string {
-	parts := make([]string, 3)
+	parts := make([]string, 4)
 	parts[0] = fmt.Sprintf("%s > %s", r.From, r.To)
 	if len(r.Before) > 0 || len(r.After) > 0 {
 		parts[1] = fmt.Sprintf(" / %s_%s", r.Before, r.After)
@@ -62,6 +82,9 @@ func (r *Rule) String() string {
 	if len(r.UnBefore) > 0 || len(r.UnAfter) > 0 {
 		parts[2] = fmt.Sprintf(" ! %s_%s", r.UnBefore, r.UnAfter)
 	}
+	if len(r.Modifiers) > 0 {
+		parts[3] = fmt.Sprintf(" ; %s", r.Modifiers)
+	}
 	return strings.Join(parts, "")
 }
 
@@ -74,32 +97,44 @@ func (c Comment) Apply(word string) (output, debug string, err error) {
 }
 
 // ParseRuleCat takes a line and parses it as a rule or a category, adding it
-// to the RuleList
+// to the RuleList. If the RuleList has a normalize directive, the line is
+// normalized first
 func (rl *RuleList) ParseRuleCat(line string) error {
-	line = strings.TrimSpace(line)
+	rl.lineCount++
+	line = rl.Normalize(strings.TrimSpace(line))
 	switch {
 	case len(line) == 0:
 		// empty line, do nothing
 	case strings.HasPrefix(line, commentstr):
 		// Don't parse, it's a comment
-		rl.Lines = append(rl.Lines, Comment(line))
+		rl.addLine(Comment(line))
+	case strings.HasPrefix(line, directivestr) && (isDirective(line) || !strings.Contains(line, arrowstr)):
+		// a line starting with `@` which isn't a directive may be a rule
+		// written in X-SAMPA, such as `@ > 0 / _#`
+		err := rl.parseDirective(line)
+		if err != nil {
+			return err
+		}
+		rl.addLine(Directive(line))
 	case strings.Contains(line, arrowstr):
 		r, err := ParseRule(line)
 		if err != nil {
 			return err
 		}
-		cr, err := r.Compile(rl.Categories)
+		rl.transcribeRule(r)
+		cr, err := rl.CompileRule(r)
 		if err != nil {
 			return err
 		}
-		rl.Lines = append(rl.Lines, cr)
+		cr.file, cr.line = rl.Filename, rl.lineCount
+		rl.addLine(cr)
 	case strings.Contains(line, equalstr):
 		cat, err := rl.parseCategory(line)
 		if err != nil {
 			return err
 		}
 		rl.Categories[cat.Name] = cat
-		rl.Lines = append(rl.Lines, cat)
+		rl.addLine(cat)
 	default:
 		return fmt.Errorf("parse error: `%s` is not a valid rule or category", line)
 	}
@@ -109,16 +144,17 @@ func (rl *RuleList) ParseRuleCat(line string) error {
 // parseRule parses a line as a rule
 func ParseRule(line string) (*Rule, error) {
 	matches := ruleRegExp.FindStringSubmatch(line)
-	if len(matches) < 7 {
+	if len(matches) < 8 {
 		return nil, fmt.Errorf("parse error: `%s` is not a valid rule", line)
 	}
 	rule := &Rule{
-		From:     matches[1],
-		To:       matches[2],
-		Before:   matches[3],
-		After:    matches[4],
-		UnBefore: matches[5],
-		UnAfter:  matches[6],
+		From:      matches[1],
+		To:        matches[2],
+		Before:    matches[3],
+		After:     matches[4],
+		UnBefore:  matches[5],
+		UnAfter:   matches[6],
+		Modifiers: strings.TrimSpace(matches[7]),
 	}
 	return rule, nil
 }
@@ -130,7 +166,7 @@ func (rl *RuleList) parseCategory(line string) (*Category, error) {
 	if val, ok := rl.Categories[key]; ok {
 		return nil, fmt.Errorf("category error: category '%s' already defined as %v", key, val)
 	}
-	values := split[1]
+	values := rl.transcribe(split[1])
 	for k, v := range rl.Categories {
 		values = strings.Replace(values, "{"+k+"}", v.ElemString(), -1)
 	}
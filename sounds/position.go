@@ -0,0 +1,72 @@
+package sounds
+
+import (
+	"unicode/utf8"
+)
+
+// filterPosition discards the matches which do not meet the positional
+// modifiers of the rule. Syllable positions are checked first, and the
+// ordinal is then counted among the remaining matches
+func (cr *CompiledRule) filterPosition(word string, matches []Match) []Match {
+	if cr.Syllable != 0 {
+		bounds := cr.syllables(word)
+		syl := ordinalIndex(cr.Syllable, len(bounds)+1)
+		filtered := matches[:0]
+		for _, m := range matches {
+			if syllableOf(bounds, m.Start) == syl {
+				filtered = append(filtered, m)
+			}
+		}
+		matches = filtered
+	}
+	if cr.Nth != 0 {
+		n := ordinalIndex(cr.Nth, len(matches))
+		if n < 0 || n >= len(matches) {
+			return nil
+		}
+		return matches[n : n+1]
+	}
+	return matches
+}
+
+// ordinalIndex converts an ordinal, as returned by parseOrdinal, into an index
+// into a sequence of the given length. The index may be out of range
+func ordinalIndex(ordinal, length int) int {
+	if ordinal > 0 {
+		return ordinal - 1
+	}
+	return length + ordinal
+}
+
+// syllables returns the positions in a word at which each syllable after the
+// first begins. Syllables are found by locating their nuclei. A single
+// character between two nuclei begins the following syllable, and in a
+// cluster, only the last character does.
+func (cr *CompiledRule) syllables(word string) []int {
+	nuclei := cr.nucleus.FindAllStringIndex(word, -1)
+	if len(nuclei) < 2 {
+		return nil
+	}
+	bounds := make([]int, len(nuclei)-1)
+	for i, n := range nuclei[1:] {
+		prevEnd := nuclei[i][1]
+		if n[0] > prevEnd {
+			_, size := utf8.DecodeLastRuneInString(word[prevEnd:n[0]])
+			bounds[i] = n[0] - size
+		} else {
+			bounds[i] = n[0]
+		}
+	}
+	return bounds
+}
+
+// syllableOf returns the index of the syllable containing a position, given
+// the positions at which the syllables begin
+func syllableOf(bounds []int, pos int) int {
+	for i, b := range bounds {
+		if pos < b {
+			return i
+		}
+	}
+	return len(bounds)
+}
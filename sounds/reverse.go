@@ -0,0 +1,402 @@
+package sounds
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// DefaultMaxCandidates is the maximum number of candidates considered when
+// reversing a rule, or kept when reversing a list of rules, if no other
+// maximum is given
+const DefaultMaxCandidates = 1000
+
+// maxClassSize is the largest character class in the From of a rule which is
+// expanded when reversing it
+const maxClassSize = 64
+
+// ErrTooManyCandidates is returned when reversing a rule or list of rules
+// produces more candidates than the maximum
+var ErrTooManyCandidates = errors.New("reverse error: too many candidates")
+
+// Unapply returns the words which the RuleList could have changed into the
+// given word, sorted. Each candidate is checked by applying the RuleList to it
+// again. At most max candidates are considered for each rule and kept between
+// rules, or DefaultMaxCandidates if max is not positive
+func (rl *RuleList) Unapply(word string, max int) ([]string, error) {
+	return rl.unapply(word, nil, nil, max)
+}
+
+// UnapplyWord is like Unapply, but for a tagged word. Rules whose tag
+// conditions the word does not meet are skipped. The candidates have the same
+// tags as the word
+func (rl *RuleList) UnapplyWord(word Word, max int) ([]Word, error) {
+	candidates, err := rl.unapply(word.Text, word.Tags, nil, max)
+	if err != nil {
+		return nil, err
+	}
+	words := make([]Word, len(candidates))
+	for i, c := range candidates {
+		words[i] = Word{Text: c, Tags: word.Tags}
+	}
+	return words, nil
+}
+
+// unapply reverses each rule of the RuleList in turn, from last to first, and
+// then keeps the candidates which produce the word when the RuleList is
+// applied to them, along with the persistent rules inherited from earlier
+// files in a chain. Before each rule is reversed, the persistent rules which
+// would have been re-applied after it are reversed once, so candidates which
+// depend on a persistent rule applying more than once after the same line may
+// be missed
+func (rl *RuleList) unapply(word string, tags Tags, inherited []*CompiledRule, max int) ([]string, error) {
+	if max <= 0 {
+		max = DefaultMaxCandidates
+	}
+	target := rl.normalizeText(singleWord(word))
+	normalized := target.Words[0]
+	var patterns []CasePattern
+	if rl.settings.preserveCase {
+		target, patterns = target.lowerCase()
+	}
+	// persistent[i] is the list of persistent rules re-applied after
+	// line i
+	persistent := make([][]*CompiledRule, len(rl.Lines))
+	active := inherited
+	for i, l := range rl.Lines {
+		persistent[i] = active
+		if cr, ok := l.(*CompiledRule); ok && cr.Persist != NotPersistent {
+			active = append(active[:len(active):len(active)], cr)
+		}
+	}
+	candidates := []string{target.Words[0]}
+	for i := len(rl.Lines) - 1; i >= 0; i-- {
+		cr, ok := rl.Lines[i].(*CompiledRule)
+		if !ok {
+			continue
+		}
+		var err error
+		candidates, err = unapplyRules(persistent[i], candidates, tags, max)
+		if err != nil {
+			return nil, err
+		}
+		candidates, err = unapplyRules([]*CompiledRule{cr}, candidates, tags, max)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var out []string
+	for _, c := range candidates {
+		text := singleWord(c)
+		if patterns != nil {
+			text = text.restoreCase(patterns)
+		}
+		output, _, err := rl.apply(text, tags, inherited)
+		if err != nil {
+			return nil, err
+		}
+		if output.Words[0] == normalized {
+			out = append(out, text.Words[0])
+		}
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// unapplyRules reverses a list of rules, from last to first, for each of a
+// list of candidates, and returns the new candidates without duplicates
+func unapplyRules(rules []*CompiledRule, candidates []string, tags Tags, max int) ([]string, error) {
+	for i := len(rules) - 1; i >= 0; i-- {
+		var next []string
+		seen := make(map[string]bool)
+		for _, c := range candidates {
+			prev, err := rules[i].UnapplyTagged(c, tags, max)
+			if err != nil {
+				return nil, err
+			}
+			for _, p := range prev {
+				if !seen[p] {
+					seen[p] = true
+					next = append(next, p)
+				}
+			}
+		}
+		if len(next) > max {
+			return nil, ErrTooManyCandidates
+		}
+		candidates = next
+	}
+	return candidates, nil
+}
+
+// Unapply returns the words which the rule could have changed into the given
+// word, which is treated as a word with no tags
+func (cr *CompiledRule) Unapply(word string, max int) ([]string, error) {
+	return cr.UnapplyTagged(word, nil, max)
+}
+
+// UnapplyTagged returns the words with the given tags which the rule could
+// have changed into the given word, including the word itself if the rule
+// leaves it unchanged. Candidates are generated by replacing each combination
+// of places in the word which the To of the rule could have produced with each
+// string which the From of the rule matches, and are kept if applying the rule
+// to them produces the word. Where the rule deletes something, at most one
+// deletion is restored at each place, and only where the rest of the word, as
+// it stands, meets the After of the rule and not its UnAfter, so a deletion
+// whose environment depends on another restored deletion is missed. If more
+// than max candidates would be considered, ErrTooManyCandidates is returned
+func (cr *CompiledRule) UnapplyTagged(word string, tags Tags, max int) ([]string, error) {
+	if max <= 0 {
+		max = DefaultMaxCandidates
+	}
+	if !cr.AppliesTo(tags) {
+		return []string{word}, nil
+	}
+	froms, err := cr.fromStrings(max)
+	if err != nil {
+		return nil, err
+	}
+	to, err := cr.toPattern()
+	if err != nil {
+		return nil, err
+	}
+	// spans are the places in the word which the To could have produced
+	var spans [][2]int
+	for i := 0; i <= len(word); {
+		if loc := to.FindStringIndex(word[i:]); loc != nil {
+			spans = append(spans, [2]int{i, i + loc[1]})
+		}
+		if i == len(word) {
+			break
+		}
+		_, n := utf8.DecodeRuneInString(word[i:])
+		i += n
+	}
+	var (
+		out   []string
+		tried int
+	)
+	seen := make(map[string]bool)
+	// build adds candidates which replace some of the spans from k onward,
+	// given the candidate built so far, which ends at pos in the word
+	var build func(k, pos int, prefix string) error
+	build = func(k, pos int, prefix string) error {
+		if k == len(spans) {
+			tried++
+			if tried > max {
+				return ErrTooManyCandidates
+			}
+			candidate := prefix + word[pos:]
+			if seen[candidate] {
+				return nil
+			}
+			seen[candidate] = true
+			output, _, err := cr.ApplyTagged(candidate, tags)
+			if err != nil {
+				return err
+			}
+			if output == word {
+				out = append(out, candidate)
+			}
+			return nil
+		}
+		// leave this span as it is
+		if err := build(k+1, pos, prefix); err != nil {
+			return err
+		}
+		s := spans[k]
+		if s[0] < pos {
+			// overlaps a span which has already been replaced
+			return nil
+		}
+		for _, f := range froms {
+			p := prefix + word[pos:s[0]]
+			// the Before of the rule only depends on what precedes
+			// the match, so candidates which fail it are dropped
+			// early
+			indices := cr.From.categoryMatch(f, nil)
+			if cr.Before.categoryMatch(p, indices) == nil {
+				continue
+			}
+			if cr.UnBefore.categoryMatch(p, indices) != nil {
+				continue
+			}
+			// the To of a deletion matches everywhere, so unless
+			// restoring a deletion is limited to where the rest of
+			// the word meets the After of the rule, every subset
+			// of the places in the word would be tried
+			if s[0] == s[1] {
+				rest := word[s[1]:]
+				if cr.After.categoryMatch(rest, indices) == nil {
+					continue
+				}
+				if cr.UnAfter.categoryMatch(rest, indices) != nil {
+					continue
+				}
+			}
+			if err := build(k+1, s[1], p+f); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := build(0, 0, ""); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// toPattern compiles a regular expression which matches the strings which the
+// To of the rule can produce, at the start of a string
+func (cr *CompiledRule) toPattern() (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^(?:")
+	last := 0
+	for _, loc := range replMatcher.FindAllStringSubmatchIndex(cr.To, -1) {
+		b.WriteString(regexp.QuoteMeta(cr.To[last:loc[0]]))
+		name := cr.To[loc[4]:loc[5]]
+		cat, ok := cr.Categories[name]
+		if !ok {
+			return nil, fmt.Errorf("reverse error: category %#v is not defined", name)
+		}
+		// the elements of the category, with any diacritic
+		// operations applied
+		ops := cr.To[loc[6]:loc[7]]
+		elems := make([]string, 0, cat.Length())
+		optional := false
+		for i := 0; i < cat.Length(); i++ {
+			e := applyDiacritics(cat.Get(i), ops, cr.form)
+			if e == "" {
+				optional = true
+				continue
+			}
+			elems = append(elems, regexp.QuoteMeta(e))
+		}
+		sort.SliceStable(elems, func(i, j int) bool {
+			return len(elems[i]) > len(elems[j])
+		})
+		if optional {
+			elems = append(elems, "")
+		}
+		fmt.Fprintf(&b, "(?:%s)", strings.Join(elems, "|"))
+		last = loc[1]
+	}
+	b.WriteString(regexp.QuoteMeta(cr.To[last:]))
+	b.WriteString(")")
+	return regexp.Compile(b.String())
+}
+
+// fromStrings returns the strings which the From of the rule matches. A
+// repetition is expanded at most once beyond its minimum, so `a*` matches the
+// empty string and `a`. It is an error if the From matches any character, or
+// more than max strings
+func (cr *CompiledRule) fromStrings(max int) ([]string, error) {
+	re, err := syntax.Parse(cr.From.String(), syntax.Perl)
+	if err != nil {
+		return nil, err
+	}
+	strs, err := expand(re.Simplify(), max)
+	if err == ErrTooManyCandidates {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reverse error: cannot reverse `%s`: %v", cr, err)
+	}
+	return strs, nil
+}
+
+// expand returns the strings which a parsed regular expression matches, as
+// described for fromStrings
+func expand(re *syntax.Regexp, max int) ([]string, error) {
+	switch re.Op {
+	case syntax.OpEmptyMatch, syntax.OpBeginLine, syntax.OpEndLine,
+		syntax.OpBeginText, syntax.OpEndText, syntax.OpWordBoundary,
+		syntax.OpNoWordBoundary:
+		return []string{""}, nil
+	case syntax.OpLiteral:
+		return []string{string(re.Rune)}, nil
+	case syntax.OpCharClass:
+		var strs []string
+		for i := 0; i+1 < len(re.Rune); i += 2 {
+			for r := re.Rune[i]; r <= re.Rune[i+1]; r++ {
+				if len(strs) >= maxClassSize {
+					return nil, fmt.Errorf("character class is too large")
+				}
+				strs = append(strs, string(r))
+			}
+		}
+		return strs, nil
+	case syntax.OpCapture:
+		return expand(re.Sub[0], max)
+	case syntax.OpQuest, syntax.OpStar:
+		strs, err := expand(re.Sub[0], max)
+		if err != nil {
+			return nil, err
+		}
+		return append([]string{""}, strs...), nil
+	case syntax.OpPlus:
+		return expand(re.Sub[0], max)
+	case syntax.OpRepeat:
+		strs := []string{""}
+		for i := 0; i < re.Min; i++ {
+			var err error
+			if strs, err = product(strs, re.Sub[0], max); err != nil {
+				return nil, err
+			}
+		}
+		if re.Max != re.Min {
+			more, err := product(strs, re.Sub[0], max)
+			if err != nil {
+				return nil, err
+			}
+			strs = append(strs, more...)
+		}
+		return strs, nil
+	case syntax.OpConcat:
+		strs := []string{""}
+		for _, sub := range re.Sub {
+			var err error
+			if strs, err = product(strs, sub, max); err != nil {
+				return nil, err
+			}
+		}
+		return strs, nil
+	case syntax.OpAlternate:
+		var strs []string
+		for _, sub := range re.Sub {
+			s, err := expand(sub, max)
+			if err != nil {
+				return nil, err
+			}
+			strs = append(strs, s...)
+			if len(strs) > max {
+				return nil, ErrTooManyCandidates
+			}
+		}
+		return strs, nil
+	}
+	return nil, fmt.Errorf("%v matches any character", re)
+}
+
+// product returns each of the strings followed by each of the strings which
+// the regular expression matches
+func product(strs []string, re *syntax.Regexp, max int) ([]string, error) {
+	suffixes, err := expand(re, max)
+	if err != nil {
+		return nil, err
+	}
+	if len(strs)*len(suffixes) > max {
+		return nil, ErrTooManyCandidates
+	}
+	out := make([]string, 0, len(strs)*len(suffixes))
+	for _, s := range strs {
+		for _, t := range suffixes {
+			out = append(out, s+t)
+		}
+	}
+	return out, nil
+}
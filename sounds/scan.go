@@ -0,0 +1,79 @@
+package sounds
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ScanTree builds the language tree implied by the dot-separated names of the
+// sound change files whose paths start with a prefix, as used by Pairs. The
+// parent of `latin.vulgar` is `latin`, and so on. Ancestors which are implied
+// by the names of their descendants, but which have no file of their own, are
+// included in the tree, and marked as missing. Files whose names don't
+// continue with a valid language name after the prefix, as checked by Route,
+// are skipped, so hidden files, backups such as `latin~` and names with empty
+// parts such as `latin..french` are not languages
+func ScanTree(prefix string) (*Tree, error) {
+	dir, base := filepath.Split(prefix)
+	if dir == "" {
+		dir = "."
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]string)
+	var names []string
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasPrefix(e.Name(), base) {
+			continue
+		}
+		name := strings.TrimPrefix(e.Name(), base)
+		if !validName(name) {
+			continue
+		}
+		files[name] = filepath.Join(dir, e.Name())
+		names = append(names, name)
+	}
+	// add the missing ancestors
+	for _, name := range names {
+		for _, ancestor := range splitAll(name, ".") {
+			if _, ok := files[ancestor]; !ok {
+				files[ancestor] = ""
+			}
+		}
+	}
+	names = names[:0]
+	for name := range files {
+		names = append(names, name)
+	}
+	// sorting puts each parent before its children
+	sort.Strings(names)
+	t := NewTree()
+	for _, name := range names {
+		n := &Node{Name: name, File: files[name], Missing: files[name] == ""}
+		if i := strings.LastIndex(name, "."); i >= 0 {
+			n.Parent = t.Nodes[name[:i]]
+			n.Parent.Children = append(n.Parent.Children, n)
+		} else {
+			t.Roots = append(t.Roots, n)
+		}
+		t.Nodes[name] = n
+	}
+	return t, nil
+}
+
+// Missing returns the names of the nodes of the tree which are marked as
+// missing, sorted
+func (t *Tree) Missing() []string {
+	var missing []string
+	for name, n := range t.Nodes {
+		if n.Missing {
+			missing = append(missing, name)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
@@ -0,0 +1,108 @@
+package sounds
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// An Inventory is a set of segments, which may be longer than a single
+// character, such as affricates or sounds with diacritics. It is used to split
+// words into segments, so that rules never match part of a segment
+type Inventory struct {
+	// segments are sorted from longest to shortest, so that the first
+	// segment which matches is the longest
+	segments []string
+	set      map[string]bool
+}
+
+// NewInventory returns an inventory containing the given segments. Repeated
+// segments, and the zero element `0`, are ignored
+func NewInventory(segments []string) *Inventory {
+	inv := &Inventory{set: make(map[string]bool)}
+	for _, s := range segments {
+		if s == "0" || s == "" || inv.set[s] {
+			continue
+		}
+		inv.set[s] = true
+		inv.segments = append(inv.segments, s)
+	}
+	sort.SliceStable(inv.segments, func(i, j int) bool {
+		return len(inv.segments[i]) > len(inv.segments[j])
+	})
+	return inv
+}
+
+// Equal compares two Inventories by value
+func (inv *Inventory) Equal(other *Inventory) bool {
+	if inv == nil || other == nil {
+		return inv == other
+	}
+	if len(inv.set) != len(other.set) {
+		return false
+	}
+	for s := range inv.set {
+		if !other.set[s] {
+			return false
+		}
+	}
+	return true
+}
+
+// Has reports whether a segment is in the inventory
+func (inv *Inventory) Has(segment string) bool {
+	return inv.set[segment]
+}
+
+// Segment splits a word into segments, taking the longest segment in the
+// inventory at each point. Runs of whitespace are kept together as a single
+// segment, and any other character not in the inventory is a segment by
+// itself. The segments can be joined to produce the original word
+func (inv *Inventory) Segment(word string) []string {
+	var segs []string
+	for len(word) > 0 {
+		n := inv.next(word)
+		segs = append(segs, word[:n])
+		word = word[n:]
+	}
+	return segs
+}
+
+// Unknown returns the segments of a word which are not in the inventory,
+// excluding whitespace, in the order they occur
+func (inv *Inventory) Unknown(word string) []string {
+	var unknown []string
+	for _, s := range inv.Segment(word) {
+		if !inv.set[s] && strings.TrimSpace(s) != "" {
+			unknown = append(unknown, s)
+		}
+	}
+	return unknown
+}
+
+// boundaries returns the set of positions in a word at which a segment begins
+// or ends
+func (inv *Inventory) boundaries(word string) map[int]bool {
+	bounds := map[int]bool{0: true}
+	pos := 0
+	for pos < len(word) {
+		pos += inv.next(word[pos:])
+		bounds[pos] = true
+	}
+	return bounds
+}
+
+// next returns the length of the segment at the start of a word
+func (inv *Inventory) next(word string) int {
+	for _, s := range inv.segments {
+		if strings.HasPrefix(word, s) {
+			return len(s)
+		}
+	}
+	r, n := utf8.DecodeRuneInString(word)
+	if unicode.IsSpace(r) {
+		n = len(word) - len(strings.TrimLeftFunc(word, unicode.IsSpace))
+	}
+	return n
+}
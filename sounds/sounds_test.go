@@ -1,7 +1,12 @@
 package sounds
 
 import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
 	"regexp"
+	"strings"
 	"testing"
 )
 
@@ -97,6 +102,16 @@ func TestParseRule(t *testing.T) {
 			rule: &Rule{From: "a", To: "b", After: "d"},
 			err:  false,
 		},
+		{
+			arg:  "a > b / c_ ; first +verb",
+			rule: &Rule{From: "a", To: "b", Before: "c", Modifiers: "first +verb"},
+			err:  false,
+		},
+		{
+			arg:  "a > b / c_ ; persist",
+			rule: &Rule{From: "a", To: "b", Before: "c", Modifiers: "persist"},
+			err:  false,
+		},
 	}
 	for _, tab := range tables {
 		rule, err := ParseRule(tab.arg)
@@ -214,11 +229,60 @@ func TestFindMatches(t *testing.T) {
 				{Start: 0, End: 1, Indices: map[int]int{0: 0}},
 			},
 		},
+		{
+			rule: "a > e ; first",
+			word: "banana",
+			matches: []Match{
+				{Start: 1, End: 2, Indices: map[int]int{}},
+			},
+		},
+		{
+			rule: "a > e ; nth=-2",
+			word: "banana",
+			matches: []Match{
+				{Start: 3, End: 4, Indices: map[int]int{}},
+			},
+		},
+		{
+			rule:    "a > e ; nth=4",
+			word:    "banana",
+			matches: []Match{},
+		},
+		{
+			rule: "{V} > e ; syllable=last",
+			word: "kentum",
+			matches: []Match{
+				{Start: 4, End: 5, Indices: map[int]int{}},
+			},
+		},
+		{
+			rule: "n > m ; syllable=first",
+			word: "kentum",
+			matches: []Match{
+				{Start: 2, End: 3, Indices: map[int]int{}},
+			},
+		},
+		{
+			rule: "{V} > e ; syllable=-2 last",
+			word: "banana",
+			matches: []Match{
+				{Start: 3, End: 4, Indices: map[int]int{}},
+			},
+		},
+		{
+			rule: "k > x ; syllable=last first",
+			word: "akak",
+			matches: []Match{
+				{Start: 1, End: 2, Indices: map[int]int{}},
+			},
+		},
 	}
 	rl := NewRuleList()
-	rl.ParseRuleCat("P = p t k")
-	rl.ParseRuleCat("N = m n ŋ")
-	rl.ParseRuleCat("W = w 0 ɣ")
+	for _, line := range []string{"P = p t k", "N = m n ŋ", "W = w 0 ɣ", "V = a e i o u", "@nucleus {V}"} {
+		if err := rl.ParseRuleCat(line); err != nil {
+			t.Fatal(err)
+		}
+	}
 	for _, tab := range tables {
 		rule, err := ParseRule(tab.rule)
 		if err != nil {
@@ -295,6 +359,36 @@ func TestApply(t *testing.T) {
 			output: "topa tacoa",
 			err:    false,
 		},
+		{
+			rule:   "{Vu} > {Vu}+\u0303 / _{N}",
+			word:   "pan tam",
+			output: "pãn tãm",
+			err:    false,
+		},
+		{
+			rule:   "{Va} > {Va}-\u0301+\u0300",
+			word:   "pán",
+			output: "pàn",
+			err:    false,
+		},
+		{
+			rule:   "{Va} > {Va}-\u0301+\u0300",
+			word:   "pa\u0301n",
+			output: "pàn",
+			err:    false,
+		},
+		{
+			rule:   "{0:Va} > {0:Vu}",
+			word:   "pa\u0301n",
+			output: "pan",
+			err:    false,
+		},
+		{
+			rule:   "{Vu}{Vu} > {Vu}+ː",
+			word:   "taap",
+			output: "taːp",
+			err:    false,
+		},
 		{
 			rule:   "{0:Vu} > {0:Va} / #({C}+{V1})*{C}+_({C}+{V0})*{C}*#",
 			word:   "tap tapak takatə",
@@ -303,13 +397,11 @@ func TestApply(t *testing.T) {
 		},
 	}
 	rl := NewRuleList()
-	rl.ParseRuleCat("P = p t k")
-	rl.ParseRuleCat("N = m n ŋ")
-	rl.ParseRuleCat("C = {P} {N}")
-	rl.ParseRuleCat("Vu = a e i o u")
-	rl.ParseRuleCat("Va = á é í ó ú")
-	rl.ParseRuleCat("V0 = ə")
-	rl.ParseRuleCat("V1 = {Vu} {V0}")
+	for _, line := range []string{"P = p t k", "N = m n ŋ", "C = {P} {N}", "Vu = a e i o u", "Va = á é í ó ú", "V0 = ə", "V1 = {Vu} {V0}"} {
+		if err := rl.ParseRuleCat(line); err != nil {
+			t.Fatal(err)
+		}
+	}
 	for _, tab := range tables {
 		rule, err := ParseRule(tab.rule)
 		if err != nil {
@@ -330,60 +422,1865 @@ func TestApply(t *testing.T) {
 		case !tab.err && err == nil:
 			if tab.output != output {
 				t.Errorf("Apply(%#v, %#v) produced the output %#v instead of %#v", tab.rule, tab.word, output, tab.output)
-				s, nc, err := rl.Categories.categoryReplace("({C}+{V1})")
+				s, nc, _, err := rl.Categories.categoryReplace("({C}+{V1})", nil)
 				t.Logf("%v %v %v", s, nc, err)
 			}
 		}
 	}
 }
 
-func TestApplyFile(t *testing.T) {
+func TestCompileUnnumbered(t *testing.T) {
+	tables := []struct {
+		rule string
+		err  bool
+	}{
+		{"{V} > {V}+ː", false},
+		{"{V}{V} > {V}{V}", false},
+		{"{V} > {C}", true},
+		{"{V} > {V}{V}", true},
+		{"0 > {V} / k_", true},
+	}
+	rl := NewRuleList()
+	for _, line := range []string{"C = p t k", "V = a e i"} {
+		if err := rl.ParseRuleCat(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, tab := range tables {
+		rule, err := ParseRule(tab.rule)
+		if err != nil {
+			t.Errorf("ParseRule(%#v) incorrectly produced the error %#v", tab.rule, err)
+			continue
+		}
+		_, err = rl.CompileRule(rule)
+		switch {
+		case tab.err && err == nil:
+			t.Errorf("RuleList.CompileRule(%#v) failed to produce an error", tab.rule)
+		case !tab.err && err != nil:
+			t.Errorf("RuleList.CompileRule(%#v) incorrectly produced the error %#v", tab.rule, err)
+		}
+	}
+}
+
+func TestPersist(t *testing.T) {
 	tables := []struct {
+		lines  []string
 		word   string
 		output string
 		err    bool
 	}{
 		{
-			word:   "bp",
-			output: "pp",
+			lines:  []string{"ww > w ; persist", "a > w"},
+			word:   "awa",
+			output: "w",
 			err:    false,
 		},
 		{
-			word:   "mbp",
-			output: "mbp",
+			lines:  []string{"a > w", "ww > w ; persist", "e > w"},
+			word:   "awe",
+			output: "w",
 			err:    false,
 		},
 		{
-			word:   "abadega",
-			output: "awaeɣa",
+			lines:  []string{"ww > w ; persist=chain", "e > w"},
+			word:   "ewwe",
+			output: "w",
 			err:    false,
 		},
 		{
-			word:   "abadegam",
-			output: "amaeŋam",
-			err:    false,
+			lines:  []string{"b > ab ; persist", "a > b"},
+			word:   "a",
+			output: "",
+			err:    true,
+		},
+		{
+			lines:  []string{"ww > w ; persist=forever"},
+			word:   "ww",
+			output: "",
+			err:    true,
 		},
 	}
-	filename := "test_sc"
-	rl, err := LoadFile(filename)
-	if err != nil {
-		t.Fatalf("LoadFile(%#v) incorrectly produced the error %#v", filename, err)
+	for _, tab := range tables {
+		rl := NewRuleList()
+		var err error
+		for _, l := range tab.lines {
+			if err = rl.ParseRuleCat(l); err != nil {
+				break
+			}
+		}
+		var output string
+		if err == nil {
+			output, _, err = rl.Apply(tab.word)
+		}
+		switch {
+		case tab.err && err == nil:
+			t.Errorf("Apply(%#v, %#v) failed to produce an error", tab.lines, tab.word)
+		case !tab.err && err != nil:
+			t.Errorf("Apply(%#v, %#v) incorrectly produced the error %v", tab.lines, tab.word, err)
+		case !tab.err && err == nil:
+			if tab.output != output {
+				t.Errorf("Apply(%#v, %#v) produced the output %#v instead of %#v", tab.lines, tab.word, output, tab.output)
+			}
+		}
+	}
+}
+
+func TestApplyWord(t *testing.T) {
+	tables := []struct {
+		line   string
+		output string
+	}{
+		{
+			line:   "kata",
+			output: "keta",
+		},
+		{
+			line:   "kata\tverb",
+			output: "kata",
+		},
+		{
+			line:   "kata\tnoun loan",
+			output: "keta",
+		},
+		{
+			line:   "kata\tnoun",
+			output: "keto",
+		},
+	}
+	rl := NewRuleList()
+	for _, line := range []string{"a > e / k_ ; -verb", "a > o / t_ ; +noun -loan"} {
+		if err := rl.ParseRuleCat(line); err != nil {
+			t.Fatal(err)
+		}
 	}
 	for _, tab := range tables {
-		output, _, err := rl.Apply(tab.word)
+		word := ParseWord(tab.line)
+		output, _, err := rl.ApplyWord(word)
+		switch {
+		case err != nil:
+			t.Errorf("ApplyWord(%#v) incorrectly produced the error %v", word, err)
+		case output.Text != tab.output:
+			t.Errorf("ApplyWord(%#v) produced the output %#v instead of %#v", word, output.Text, tab.output)
+		}
+	}
+}
+
+func TestBoundary(t *testing.T) {
+	tables := []struct {
+		boundary string
+		word     string
+		output   string
+		err      bool
+	}{
+		{
+			boundary: "",
+			word:     "top-taco l'eau",
+			output:   "top-tacoa l'eaua",
+			err:      false,
+		},
+		{
+			boundary: "@boundary space hyphen",
+			word:     "top-taco l'eau",
+			output:   "topa-tacoa l'eaua",
+			err:      false,
+		},
+		{
+			boundary: "@boundary space apostrophe",
+			word:     "top-taco l'eau",
+			output:   "top-tacoa la'eaua",
+			err:      false,
+		},
+		{
+			boundary: "@boundary punct =",
+			word:     "top=taco, l'eau.",
+			output:   "topa=tacoa, l'eaua.a",
+			err:      false,
+		},
+		{
+			boundary: "@boundary",
+			word:     "",
+			output:   "",
+			err:      true,
+		},
+	}
+	for _, tab := range tables {
+		rl := NewRuleList()
+		var (
+			output string
+			err    error
+		)
+		if tab.boundary != "" {
+			err = rl.ParseRuleCat(tab.boundary)
+		}
+		if err == nil {
+			err = rl.ParseRuleCat("0 > a / _#")
+		}
+		if err == nil {
+			output, _, err = rl.Apply(tab.word)
+		}
 		switch {
 		case tab.err && err == nil:
-			t.Errorf("Apply(%#v) failed to produce an error", tab.word)
+			t.Errorf("Apply(%#v) with %#v failed to produce an error", tab.word, tab.boundary)
 		case !tab.err && err != nil:
-			t.Errorf("Apply(%#v) incorrectly produced the error %v", tab.word, err)
+			t.Errorf("Apply(%#v) with %#v incorrectly produced the error %v", tab.word, tab.boundary, err)
 		case !tab.err && err == nil:
 			if tab.output != output {
-				t.Errorf("Apply(%#v) produced the output %#v instead of %#v", tab.word, output, tab.output)
+				t.Errorf("Apply(%#v) with %#v produced the output %#v instead of %#v", tab.word, tab.boundary, output, tab.output)
+			}
+		}
+	}
+}
+
+func TestBoundaryText(t *testing.T) {
+	tables := []struct {
+		boundary string
+		text     string
+		output   string
+	}{
+		{
+			boundary: "",
+			text:     "kato-kato lo'po tan pato",
+			output:   "kato-katu lo'pu tam patu",
+		},
+		{
+			boundary: "@boundary space hyphen",
+			text:     "kato-kato lo'po tan pato",
+			output:   "katu-katu lo'pu tam patu",
+		},
+		{
+			boundary: "@boundary space apostrophe",
+			text:     "kato-kato lo'po tan pato",
+			output:   "kato-katu lu'pu tam patu",
+		},
+		{
+			boundary: "@boundary =",
+			text:     "tan=pato tan pato",
+			output:   "tam=patu tan patu",
+		},
+	}
+	for _, tab := range tables {
+		rl := NewRuleList()
+		if tab.boundary != "" {
+			if err := rl.ParseRuleCat(tab.boundary); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, rule := range []string{"o > u / _#", "n > m / _#p ; sandhi"} {
+			if err := rl.ParseRuleCat(rule); err != nil {
+				t.Fatal(err)
+			}
+		}
+		output, _, err := rl.ApplyText(tab.text)
+		switch {
+		case err != nil:
+			t.Errorf("ApplyText(%#v) with %#v incorrectly produced the error %v", tab.text, tab.boundary, err)
+		case tab.output != output:
+			t.Errorf("ApplyText(%#v) with %#v produced the output %#v instead of %#v", tab.text, tab.boundary, output, tab.output)
+		}
+	}
+}
+
+func TestSegments(t *testing.T) {
+	tables := []struct {
+		rule   string
+		word   string
+		output string
+	}{
+		{
+			rule:   "s > z",
+			word:   "tsasa",
+			output: "tsaza",
+		},
+		{
+			rule:   "a > e / s_",
+			word:   "tsa sa",
+			output: "tsa se",
+		},
+		{
+			rule:   "a > e ! t_",
+			word:   "tsa ta",
+			output: "tse ta",
+		},
+		{
+			rule:   "{C} > x / _#",
+			word:   "kats",
+			output: "kax",
+		},
+		{
+			rule:   "ss > S",
+			word:   "tsss",
+			output: "tsS",
+		},
+	}
+	rl := NewRuleList()
+	for _, line := range []string{"C = p t k ts s", "V = a e", "@segments {C} {V}"} {
+		if err := rl.ParseRuleCat(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, tab := range tables {
+		rule, err := ParseRule(tab.rule)
+		if err != nil {
+			t.Errorf("ParseRule(%#v) incorrectly produced the error %#v", tab.rule, err)
+			continue
+		}
+		cr, err := rl.CompileRule(rule)
+		if err != nil {
+			t.Errorf("RuleList.CompileRule(%#v) incorrectly produced the error %#v", tab.rule, err)
+			continue
+		}
+		output, _, err := cr.Apply(tab.word)
+		switch {
+		case err != nil:
+			t.Errorf("Apply(%#v, %#v) incorrectly produced the error %#v", tab.rule, tab.word, err)
+		case tab.output != output:
+			t.Errorf("Apply(%#v, %#v) produced the output %#v instead of %#v", tab.rule, tab.word, output, tab.output)
+		}
+	}
+	inv := rl.Inventory()
+	word := "tsaxa  bs"
+	segs := []string{"ts", "a", "x", "a", "  ", "b", "s"}
+	if out := inv.Segment(word); !stringSliceEqual(out, segs) {
+		t.Errorf("Segment(%#v) produced %#v instead of %#v", word, out, segs)
+	}
+	unknown := []string{"x", "b"}
+	if out := inv.Unknown(word); !stringSliceEqual(out, unknown) {
+		t.Errorf("Unknown(%#v) produced %#v instead of %#v", word, out, unknown)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tables := []struct {
+		lines  []string
+		word   string
+		output string
+		err    bool
+	}{
+		{
+			lines:  []string{"V = a e\u0301", "{V} > o"},
+			word:   "t\u00e9",
+			output: "to",
+			err:    false,
+		},
+		{
+			lines:  []string{"e\u0301 > o"},
+			word:   "t\u00e9",
+			output: "t\u00e9",
+			err:    false,
+		},
+		{
+			lines:  []string{"@normalize nfc", "V = a e\u0301", "{V} > o"},
+			word:   "t\u00e9",
+			output: "to",
+			err:    false,
+		},
+		{
+			lines:  []string{"@normalize NFD", "\u00e9 > i"},
+			word:   "te\u0301",
+			output: "ti",
+			err:    false,
+		},
+		{
+			lines:  []string{"@normalize nfd", "e > i"},
+			word:   "t\u00e9",
+			output: "ti\u0301",
+			err:    false,
+		},
+		{
+			lines:  []string{"V = a e", "@normalize nfc"},
+			word:   "",
+			output: "",
+			err:    true,
+		},
+		{
+			lines:  []string{"@normalize nfx"},
+			word:   "",
+			output: "",
+			err:    true,
+		},
+	}
+	for _, tab := range tables {
+		rl := NewRuleList()
+		var err error
+		for _, l := range tab.lines {
+			if err = rl.ParseRuleCat(l); err != nil {
+				break
+			}
+		}
+		var output string
+		if err == nil {
+			output, _, err = rl.Apply(tab.word)
+		}
+		switch {
+		case tab.err && err == nil:
+			t.Errorf("Apply(%#v, %#v) failed to produce an error", tab.lines, tab.word)
+		case !tab.err && err != nil:
+			t.Errorf("Apply(%#v, %#v) incorrectly produced the error %v", tab.lines, tab.word, err)
+		case !tab.err && err == nil:
+			if tab.output != output {
+				t.Errorf("Apply(%#v, %#v) produced the output %#v instead of %#v", tab.lines, tab.word, output, tab.output)
 			}
 		}
 	}
 }
 
+func TestTranscription(t *testing.T) {
+	tables := []struct {
+		lines  []string
+		word   string
+		output string
+		err    bool
+	}{
+		{
+			lines:  []string{"@transcription xsampa", "S > s"},
+			word:   "ʃip",
+			output: "sip",
+			err:    false,
+		},
+		{
+			lines:  []string{"@transcription xsampa", "t_h > T / _{"},
+			word:   "tʰæ",
+			output: "θæ",
+			err:    false,
+		},
+		{
+			lines:  []string{"@transcription xsampa", "V = a @ {", "{V}? > ? / #_"},
+			word:   "æt",
+			output: "ʔt",
+			err:    false,
+		},
+		{
+			lines:  []string{"@transcription xsampa", "t(a|@)? > d / _#"},
+			word:   "tə",
+			output: "d",
+			err:    false,
+		},
+		{
+			lines:  []string{"@transcription kirshenbaum", "N* > n"},
+			word:   "ŋɾa",
+			output: "na",
+			err:    false,
+		},
+		{
+			lines:  []string{"@transcription xsampa", "@transcription ipa", "S > s"},
+			word:   "Sʃ",
+			output: "sʃ",
+			err:    false,
+		},
+		{
+			lines:  []string{"@transcription xsampa", "@romanize S > sh"},
+			word:   "ʃa",
+			output: "ʃa",
+			err:    false,
+		},
+		{
+			lines:  []string{"@transcription xsampa", "@ > 0 / _#"},
+			word:   "kantə",
+			output: "kant",
+			err:    false,
+		},
+		{
+			lines:  []string{"@transcription xsampa", "@tone high"},
+			word:   "",
+			output: "",
+			err:    true,
+		},
+		{
+			lines:  []string{"@transcription sampa"},
+			word:   "",
+			output: "",
+			err:    true,
+		},
+	}
+	for _, tab := range tables {
+		rl := NewRuleList()
+		var err error
+		for _, l := range tab.lines {
+			if err = rl.ParseRuleCat(l); err != nil {
+				break
+			}
+		}
+		var output string
+		if err == nil {
+			output, _, err = rl.Apply(tab.word)
+		}
+		switch {
+		case tab.err && err == nil:
+			t.Errorf("Apply(%#v, %#v) failed to produce an error", tab.lines, tab.word)
+		case !tab.err && err != nil:
+			t.Errorf("Apply(%#v, %#v) incorrectly produced the error %v", tab.lines, tab.word, err)
+		case !tab.err && err == nil:
+			if tab.output != output {
+				t.Errorf("Apply(%#v, %#v) produced the output %#v instead of %#v", tab.lines, tab.word, output, tab.output)
+			}
+			if r := rl.Romanizer(); r != nil && r.Apply(tab.word) == tab.word {
+				t.Errorf("Romanizer for %#v did not apply to %#v", tab.lines, tab.word)
+			}
+		}
+	}
+}
+
+func TestPreserveCase(t *testing.T) {
+	tables := []struct {
+		word    string
+		pattern CasePattern
+		output  string
+	}{
+		{
+			word:    "kata",
+			pattern: LowerCase,
+			output:  "tsat",
+		},
+		{
+			word:    "Kata",
+			pattern: TitleCase,
+			output:  "Tsat",
+		},
+		{
+			word:    "KATA",
+			pattern: UpperCase,
+			output:  "TSAT",
+		},
+		{
+			word:    "Ka",
+			pattern: TitleCase,
+			output:  "Ts",
+		},
+		{
+			word:    "A",
+			pattern: TitleCase,
+			output:  "",
+		},
+		{
+			word:    "McKata",
+			pattern: MixedCase,
+			output:  "mctsat",
+		},
+		{
+			word:    "KeNTO",
+			pattern: MixedCase,
+			output:  "tsento",
+		},
+	}
+	rl := NewRuleList()
+	for _, line := range []string{"@case preserve", "k > ts", "a > 0 / _#"} {
+		if err := rl.ParseRuleCat(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, tab := range tables {
+		if pattern := DetectCase(tab.word); pattern != tab.pattern {
+			t.Errorf("DetectCase(%#v) produced %v instead of %v", tab.word, pattern, tab.pattern)
+		}
+		output, _, err := rl.Apply(tab.word)
+		switch {
+		case err != nil:
+			t.Errorf("Apply(%#v) incorrectly produced the error %v", tab.word, err)
+		case tab.output != output:
+			t.Errorf("Apply(%#v) produced the output %#v instead of %#v", tab.word, output, tab.output)
+		}
+	}
+	text := "Kata ka. KA!"
+	output := "Tsat ts. TS!"
+	if out, _, err := rl.ApplyText(text); err != nil || out != output {
+		t.Errorf("ApplyText(%#v) produced the output %#v, %v instead of %#v", text, out, err, output)
+	}
+}
+
+func TestUnapply(t *testing.T) {
+	tables := []struct {
+		lines      []string
+		word       string
+		candidates []string
+		err        bool
+	}{
+		{
+			lines:      []string{"p > f"},
+			word:       "fa",
+			candidates: []string{"fa", "pa"},
+			err:        false,
+		},
+		{
+			lines:      []string{"p > f"},
+			word:       "pa",
+			candidates: nil,
+			err:        false,
+		},
+		{
+			lines:      []string{"V = a e", "{V} > i / _#"},
+			word:       "ti",
+			candidates: []string{"ta", "te", "ti"},
+			err:        false,
+		},
+		{
+			lines:      []string{"C = p t", "D = b d", "{0:C} > {0:D} / a_a"},
+			word:       "ada",
+			candidates: []string{"ada", "ata"},
+			err:        false,
+		},
+		{
+			lines:      []string{"h > 0 / _#"},
+			word:       "ta",
+			candidates: []string{"ta", "tah"},
+			err:        false,
+		},
+		{
+			lines:      []string{"ə > 0 / _#"},
+			word:       "kantabamus",
+			candidates: []string{"kantabamus", "kantabamusə"},
+			err:        false,
+		},
+		{
+			lines:      []string{"s > z / a_a", "z > r"},
+			word:       "ara",
+			candidates: []string{"ara", "asa", "aza"},
+			err:        false,
+		},
+		{
+			lines:      []string{"@case preserve", "k > h"},
+			word:       "Ha",
+			candidates: []string{"Ha", "Ka"},
+			err:        false,
+		},
+		{
+			lines:      []string{". > a"},
+			word:       "a",
+			candidates: nil,
+			err:        true,
+		},
+		{
+			lines:      []string{"h > 0"},
+			word:       "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa",
+			candidates: nil,
+			err:        true,
+		},
+	}
+	for _, tab := range tables {
+		rl := NewRuleList()
+		for _, l := range tab.lines {
+			if err := rl.ParseRuleCat(l); err != nil {
+				t.Fatalf("ParseRuleCat(%#v) produced the error %v", l, err)
+			}
+		}
+		candidates, err := rl.Unapply(tab.word, 0)
+		switch {
+		case tab.err && err == nil:
+			t.Errorf("Unapply(%#v, %#v) failed to produce an error", tab.lines, tab.word)
+		case !tab.err && err != nil:
+			t.Errorf("Unapply(%#v, %#v) incorrectly produced the error %v", tab.lines, tab.word, err)
+		case !tab.err && err == nil:
+			if !stringSliceEqual(candidates, tab.candidates) {
+				t.Errorf("Unapply(%#v, %#v) produced %#v instead of %#v", tab.lines, tab.word, candidates, tab.candidates)
+			}
+		}
+	}
+}
+
+func TestParseText(t *testing.T) {
+	tables := []struct {
+		arg  string
+		text Text
+	}{
+		{
+			arg:  "word",
+			text: Text{Words: []string{"word"}, Seps: []string{"", ""}},
+		},
+		{
+			arg:  "Two words.",
+			text: Text{Words: []string{"Two", "words"}, Seps: []string{"", " ", "."}},
+		},
+		{
+			arg:  "\"ŋá, tə́\"",
+			text: Text{Words: []string{"ŋá", "tə́"}, Seps: []string{"\"", ", ", "\""}},
+		},
+		{
+			arg:  "...",
+			text: Text{Seps: []string{"..."}},
+		},
+	}
+	for _, tab := range tables {
+		text := ParseText(tab.arg)
+		if !text.Equal(tab.text) {
+			t.Errorf("ParseText(%#v) produced %#v instead of %#v", tab.arg, text, tab.text)
+		}
+		if text.String() != tab.arg {
+			t.Errorf("ParseText(%#v).String() produced %#v", tab.arg, text.String())
+		}
+	}
+}
+
+func TestApplyText(t *testing.T) {
+	tables := []struct {
+		text   string
+		output string
+		err    bool
+	}{
+		{
+			text:   "tan pata",
+			output: "tam pata",
+			err:    false,
+		},
+		{
+			text:   "tan, pata!",
+			output: "tan, pata!",
+			err:    false,
+		},
+		{
+			text:   "  Ana  tan kata ",
+			output: "  Ana  taŋ kata ",
+			err:    false,
+		},
+		{
+			text:   "pu pa",
+			output: "pupa",
+			err:    false,
+		},
+		{
+			text:   "kato-kato pato",
+			output: "kato-katu patu",
+			err:    false,
+		},
+		{
+			text:   "i  ta, i ka",
+			output: "i-ta, i-ka",
+			err:    false,
+		},
+	}
+	rl := NewRuleList()
+	for _, line := range []string{"P = p t k", "N = m n ŋ", "n > {0:N} / _#{0:P} ; sandhi", "u\\s > u ; sandhi", "o > u / _#", "i\\s+ > i- ; sandhi"} {
+		if err := rl.ParseRuleCat(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, tab := range tables {
+		output, _, err := rl.ApplyText(tab.text)
+		switch {
+		case tab.err && err == nil:
+			t.Errorf("ApplyText(%#v) failed to produce an error", tab.text)
+		case !tab.err && err != nil:
+			t.Errorf("ApplyText(%#v) incorrectly produced the error %v", tab.text, err)
+		case !tab.err && err == nil:
+			if tab.output != output {
+				t.Errorf("ApplyText(%#v) produced the output %#v instead of %#v", tab.text, output, tab.output)
+			}
+		}
+	}
+}
+
+func TestOrthography(t *testing.T) {
+	tables := []struct {
+		word   string
+		output string
+	}{
+		{
+			word:   "chasecax",
+			output: "tʃasekaks",
+		},
+		{
+			word:   "xashe",
+			output: "xaʃe",
+		},
+	}
+	o := &Orthography{}
+	for _, e := range []string{"c > s / _e", "c > k", "sh > ʃ", "ch > tʃ", "x > ks ! #_"} {
+		if err := o.Add(e, nil); err != nil {
+			t.Fatalf("Add(%#v) incorrectly produced the error %v", e, err)
+		}
+	}
+	for _, tab := range tables {
+		if output := o.Apply(tab.word); output != tab.output {
+			t.Errorf("Apply(%#v) produced the output %#v instead of %#v", tab.word, output, tab.output)
+		}
+	}
+}
+
+// writeFiles writes files with the given names and contents to a temporary
+// directory, as described for writeFilesIn, and returns the directory
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	writeFilesIn(t, dir, files)
+	return dir
+}
+
+// writeFilesIn writes files with the given names and contents to a directory,
+// creating any subdirectories in the names, and replacing any files which
+// already exist
+func writeFilesIn(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, contents := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestTrace(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"a": "// palatalization\nV = a i\n\nk > c / _{V}\n@romanize c > ch\n",
+	})
+	file := filepath.Join(dir, "a")
+	c := NewCache()
+	output, trace, err := c.ApplyFiles("kaki", file)
+	if err != nil || output != "caci" {
+		t.Fatalf("ApplyFiles produced %#v and %v instead of %#v", output, err, "caci")
+	}
+	expected := []string{file, "// palatalization", "V = a i", "k > c / _{V}  caci", "@romanize c > ch", "romanize  chachi"}
+	if strs := trace.Strings(); !stringSliceEqual(strs, expected) {
+		t.Errorf("Trace.Strings() produced %#v instead of %#v", strs, expected)
+	}
+	lines := []int{0, 1, 2, 4, 5, 0}
+	for i, st := range trace {
+		if st.Line != lines[i] {
+			t.Errorf("step %d of the trace is on line %d instead of %d", i, st.Line, lines[i])
+		}
+	}
+	fired := trace.Fired()
+	if len(fired) != 1 || fired[0].Input != "kaki" || fired[0].Output != "caci" || fired[0].File != file {
+		t.Fatalf("Trace.Fired() produced %#v", fired)
+	}
+	matches := []Match{{Start: 0, End: 1}, {Start: 2, End: 3}}
+	if len(fired[0].Matches) != len(matches) {
+		t.Fatalf("the rule matched at %#v instead of %#v", fired[0].Matches, matches)
+	}
+	for i, m := range fired[0].Matches {
+		if !m.Equal(matches[i]) {
+			t.Errorf("the rule matched at %#v instead of %#v", m, matches[i])
+		}
+	}
+	b, err := json.Marshal(fired[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var step Step
+	if err = json.Unmarshal(b, &step); err != nil || step.Text != fired[0].Text || step.Line != 4 || len(step.Matches) != 2 {
+		t.Errorf("JSON round trip produced %#v and %v from %s", step, err, b)
+	}
+	// sandhi matches are offsets into the whole text
+	rl := NewRuleList()
+	for _, line := range []string{"P = p t k", "N = m n ŋ", "n > {0:N} / _#{0:P} ; sandhi"} {
+		if err := rl.ParseRuleCat(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, trace, err = rl.ApplyText("  ana  tan kata ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fired = trace.Fired()
+	match := Match{Start: 9, End: 10, Indices: map[int]int{0: 2}}
+	if len(fired) != 1 || len(fired[0].Matches) != 1 || !fired[0].Matches[0].Equal(match) {
+		t.Errorf("the sandhi rule matched at %#v instead of %#v", fired, match)
+	}
+}
+
+func TestTraceSections(t *testing.T) {
+	rl := NewRuleList()
+	for _, line := range []string{"// one", "V = a i", "k > c / _{V}", "// two", "p > f", "// three", "t > th / {V}_{V}"} {
+		if err := rl.ParseRuleCat(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, trace, err := rl.Apply("kata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tables := []struct {
+		name   string
+		trace  Trace
+		output []string
+	}{
+		{
+			name:   "Changed",
+			trace:  trace.Changed(),
+			output: []string{"k > c / _{V}  cata", "t > th / {V}_{V}  catha"},
+		},
+		{
+			name:   "Sections",
+			trace:  trace.Sections(),
+			output: []string{"// one", "k > c / _{V}  cata", "// three", "t > th / {V}_{V}  catha"},
+		},
+	}
+	for _, tab := range tables {
+		if strs := tab.trace.Strings(); !stringSliceEqual(strs, tab.output) {
+			t.Errorf("Trace.%s() produced %#v instead of %#v", tab.name, strs, tab.output)
+		}
+	}
+	last := trace[len(trace)-1]
+	if len(last.Replacements) != 1 || last.Replacements[0] != [2]int{2, 4} {
+		t.Errorf("the rule replaced %#v instead of %#v", last.Replacements, [][2]int{{2, 4}})
+	}
+}
+
+func TestBlame(t *testing.T) {
+	type span struct {
+		text   string
+		line   int
+		source [2]int
+	}
+	tables := []struct {
+		word  string
+		spans []span
+	}{
+		{
+			word:  "kata",
+			spans: []span{{"c", 2, [2]int{0, 1}}, {"e", 3, [2]int{1, 2}}, {"s", 5, [2]int{2, 4}}, {"a", 0, [2]int{3, 4}}},
+		},
+		{
+			word:  "taki",
+			spans: []span{{"ta", 0, [2]int{0, 2}}, {"c", 2, [2]int{2, 3}}, {"i", 0, [2]int{3, 4}}},
+		},
+		{
+			word:  "pu",
+			spans: []span{{"pu", 0, [2]int{0, 2}}},
+		},
+	}
+	rl := NewRuleList()
+	for _, line := range []string{"V = a i e", "k > c / _{V}", "a > e / c_", "t > th / {V}_{V}", "th > s / _a"} {
+		if err := rl.ParseRuleCat(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, tab := range tables {
+		_, trace, err := rl.Apply(tab.word)
+		if err != nil {
+			t.Fatal(err)
+		}
+		blame := trace.Blame()
+		if len(blame) != len(tab.spans) {
+			t.Errorf("Blame for %#v produced %#v instead of %#v", tab.word, blame, tab.spans)
+			continue
+		}
+		for i, b := range blame {
+			line := 0
+			if b.Step != nil {
+				line = b.Step.Line
+			}
+			if sp := (span{b.Text, line, b.Source}); sp != tab.spans[i] {
+				t.Errorf("Blame for %#v produced %#v instead of %#v", tab.word, sp, tab.spans[i])
+			}
+		}
+	}
+}
+
+func TestBlameNormalized(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"a": "x > k\n",
+		"b": "@normalize nfd\nạ > a\n",
+	})
+	// normalizing puts the dot below before the acute accent, which keeps
+	// the length of the text, so blame starts again from the normalized
+	// text rather than from the input of the chain
+	res, err := NewCache().ApplyChain(Word{Text: "xa\u0301\u0323"}, filepath.Join(dir, "a"), filepath.Join(dir, "b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	type span struct {
+		text   string
+		line   int
+		source [2]int
+	}
+	expected := []span{{"k", 0, [2]int{0, 1}}, {"a", 2, [2]int{1, 4}}, {"\u0301", 0, [2]int{4, 6}}}
+	blame := res.Trace.Blame()
+	if len(blame) != len(expected) {
+		t.Fatalf("Blame produced %#v instead of %#v", blame, expected)
+	}
+	for i, b := range blame {
+		line := 0
+		if b.Step != nil {
+			line = b.Step.Line
+		}
+		if sp := (span{b.Text, line, b.Source}); sp != expected[i] {
+			t.Errorf("Blame produced %#v instead of %#v", sp, expected[i])
+		}
+	}
+}
+
+func TestCoverage(t *testing.T) {
+	rl := NewRuleList()
+	for _, line := range []string{"V = a e i", "k > c / _{V}", "", "a > e / c_", "x > y", "e > a / _#", "i > i"} {
+		if err := rl.ParseRuleCat(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	words := []Word{{Text: "ka"}, {Text: "pe"}, {Text: "ki"}}
+	cv, err := rl.Coverage(words)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []RuleCoverage{
+		{Line: 2, Rule: "k > c / _{V}", Matched: 2, Changed: 2},
+		{Line: 4, Rule: "a > e / c_", Matched: 1, Changed: 1, Undone: 1},
+		{Line: 5, Rule: "x > y"},
+		{Line: 6, Rule: "e > a / _#", Matched: 2, Changed: 2},
+		{Line: 7, Rule: "i > i", Matched: 1},
+	}
+	if cv.Words != len(words) || len(cv.Rules) != len(expected) {
+		t.Fatalf("Coverage produced %#v", cv)
+	}
+	for i, rc := range cv.Rules {
+		if rc != expected[i] {
+			t.Errorf("Coverage produced %#v instead of %#v", rc, expected[i])
+		}
+	}
+	if dead := cv.Dead(); len(dead) != 1 || dead[0].Line != 5 {
+		t.Errorf("Coverage.Dead() produced %#v", dead)
+	}
+	if undone := cv.AlwaysUndone(); len(undone) != 1 || undone[0].Line != 4 {
+		t.Errorf("Coverage.AlwaysUndone() produced %#v", undone)
+	}
+}
+
+func TestCoverageRomanized(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"a": "k > c / _e\n@romanize c > k\n",
+	})
+	cv, err := NewCache().CoverageFiles([]Word{{Text: "ke"}}, filepath.Join(dir, "a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the romanizer spells the output as the input was, but that doesn't
+	// undo the change
+	expected := RuleCoverage{File: filepath.Join(dir, "a"), Line: 1, Rule: "k > c / _e", Matched: 1, Changed: 1, Undone: 0}
+	if len(cv.Rules) != 1 || cv.Rules[0] != expected {
+		t.Errorf("CoverageFiles produced %#v instead of %#v", cv.Rules, expected)
+	}
+}
+
+func TestInteractions(t *testing.T) {
+	rl := NewRuleList()
+	for _, line := range []string{"i > e", "k > c / _e", "a > 0 / _#", "t > s / _a", "h > 0 / _u", "s > h", "o > u / _n", "n > 0 / _#"} {
+		if err := rl.ParseRuleCat(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	words := []Word{{Text: "ki"}, {Text: "ta"}, {Text: "su"}, {Text: "on"}, {Text: "kin"}}
+	in, err := rl.Interactions(words, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	interactions := in.List()
+	expected := []struct {
+		kind          InteractionKind
+		first, second int
+		count         int
+		example       [3]string
+	}{
+		{Feeding, 1, 2, 2, [3]string{"ki", "ce", "ke"}},
+		{Bleeding, 3, 4, 1, [3]string{"ta", "t", "h"}},
+		{Counterfeeding, 5, 6, 1, [3]string{"su", "hu", "u"}},
+		{Counterbleeding, 7, 8, 1, [3]string{"on", "u", "o"}},
+	}
+	if len(interactions) != len(expected) {
+		t.Fatalf("Interactions produced %#v", interactions)
+	}
+	for i, it := range interactions {
+		e := expected[i]
+		if it.Kind != e.kind || it.First.Line != e.first || it.Second.Line != e.second || it.Count != e.count ||
+			len(it.Examples) != 1 || [3]string{it.Examples[0].Word.Text, it.Examples[0].Output, it.Examples[0].Swapped} != e.example {
+			t.Errorf("Interactions produced %#v instead of %#v", it, e)
+		}
+	}
+	dot := in.DOT()
+	for _, edge := range []string{
+		`":1" -> ":2" [label="feeds (2)"];`,
+		`":6" -> ":5" [label="counterfeeds (1)" style=dashed];`,
+	} {
+		if !strings.Contains(dot, edge) {
+			t.Errorf("Interactions.DOT() produced %q, which does not contain %q", dot, edge)
+		}
+	}
+}
+
+func TestInteractionsPersistent(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"a":   "p > b ; persist=chain\n",
+		"a.b": "q > r\ne > a\nx > p / a_\n",
+	})
+	files, err := PairFiles(dir+"/", "", ".a.b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	in, err := NewCache().InteractionsFiles([]Word{{Text: "ex"}}, 1, files...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the persistent rule on line 1 of a is not mistaken for line 1 of a.b
+	interactions := in.List()
+	if len(interactions) != 1 || interactions[0].Kind != Feeding || interactions[0].First.Line != 2 || interactions[0].Second.Line != 3 {
+		t.Errorf("InteractionsFiles produced %#v", interactions)
+	}
+}
+
+func TestApplyChainForms(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"a":   "@deromanize sh > ʃ\nʃ > s / _#\n",
+		"a.b": "@romanize s > ss\na > e\n",
+	})
+	files, err := PairFiles(dir+"/", "", ".a.b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := NewCache().ApplyChain(Word{Text: "ash"}, files...)
+	switch {
+	case err != nil:
+		t.Errorf("ApplyChain incorrectly produced the error %v", err)
+	case res.Phonemic.Text != "es" || res.Spelled.Text != "ess":
+		t.Errorf("ApplyChain produced %#v and %#v instead of %#v and %#v", res.Phonemic.Text, res.Spelled.Text, "es", "ess")
+	}
+}
+
+func TestApplyChainSentence(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"a": "@romanize s > ss\nn > m / _#p ; sandhi\n",
+	})
+	c := NewCache()
+	c.Sentence = true
+	res, err := c.ApplyChain(Word{Text: "sin pas, sin"}, filepath.Join(dir, "a"))
+	switch {
+	case err != nil:
+		t.Errorf("ApplyChain incorrectly produced the error %v", err)
+	case res.Phonemic.Text != "sim pas, sin" || res.Spelled.Text != "ssim pass, ssin":
+		t.Errorf("ApplyChain produced %#v and %#v", res.Phonemic.Text, res.Spelled.Text)
+	}
+}
+
+func TestApplyChainStages(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"a":     "u > o / _m#\nm > 0 / _#\n",
+		"a.b":   "k > c / _e\n",
+		"a.b.c": "e > ie\n@romanize c > c\n",
+	})
+	files, err := PairFiles(dir+"/", "", ".a.b.c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := NewCache().ApplyChain(Word{Text: "kentum"}, files...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stages, spelled := res.Stages, res.Spelled
+	expected := []Stage{
+		{File: dir + "/a", Output: Word{Text: "kento"}},
+		{File: dir + "/a.b", Output: Word{Text: "cento"}},
+		{File: dir + "/a.b.c", Output: Word{Text: "ciento"}},
+	}
+	if len(stages) != len(expected) {
+		t.Fatalf("ApplyChain produced %#v instead of %#v", stages, expected)
+	}
+	for i, st := range stages {
+		if st.File != expected[i].File || st.Output.Text != expected[i].Output.Text {
+			t.Errorf("ApplyChain produced %#v instead of %#v", st, expected[i])
+		}
+	}
+	if spelled.Text != "ciento" {
+		t.Errorf("ApplyChain produced the spelled form %#v instead of %#v", spelled.Text, "ciento")
+	}
+}
+
+func TestTestPairs(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"a":     "u > o / _m#\nm > 0 / _#\n@test kentum => kento\n",
+		"a.b":   "k > c / _e\n@test kento => cento\n@test kentum => cento\n",
+		"a.b.c": "e > ie\n@test-chain kentum => ciento\n",
+	})
+	c := NewCache()
+	results, err := c.TestPairs(dir+"/", "", ".a.b.c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []struct {
+		file   string
+		line   int
+		files  int
+		got    string
+		passed bool
+	}{
+		{"a", 3, 1, "kento", true},
+		{"a.b", 2, 1, "cento", true},
+		{"a.b", 3, 1, "centum", false},
+		{"a.b.c", 2, 3, "ciento", true},
+	}
+	if len(results) != len(expected) {
+		t.Fatalf("TestPairs produced %d results instead of %d", len(results), len(expected))
+	}
+	for i, r := range results {
+		e := expected[i]
+		if r.File != dir+"/"+e.file || r.Line != e.line || len(r.Files) != e.files || r.Got != e.got || r.Passed() != e.passed {
+			t.Errorf("TestPairs produced %#v instead of %#v", r, e)
+		}
+	}
+	rl := NewRuleList()
+	if err := rl.ParseRuleCat("@test kentum"); err == nil {
+		t.Errorf("ParseRuleCat(%#v) failed to produce an error", "@test kentum")
+	}
+}
+
+func TestTestTranscription(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"a": "@transcription xsampa\nS > s\n@test aS => as\n@test aSa => aS\n",
+	})
+	c := NewCache()
+	results, err := c.TestPairs(dir+"/", "", ".a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []struct {
+		got    string
+		passed bool
+	}{
+		{"as", true},
+		{"asa", false},
+	}
+	if len(results) != len(expected) {
+		t.Fatalf("TestPairs produced %d results instead of %d", len(results), len(expected))
+	}
+	for i, r := range results {
+		if r.Got != expected[i].got || r.Passed() != expected[i].passed {
+			t.Errorf("TestPairs produced %#v instead of %#v", r, expected[i])
+		}
+	}
+}
+
+func TestGolden(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"a":   "u > o / _m#\nm > 0 / _#\n",
+		"a.b": "k > c / _e\n",
+	})
+	words := []Word{{Text: "kentum"}, {Text: "lupum", Tags: NewTags("noun")}, {Text: "kalum"}}
+	c := NewCache()
+	files, err := PairFiles(dir+"/", "", ".a.b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	old, err := c.GoldenFiles(words, files...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden := filepath.Join(dir, "golden.tsv")
+	if err = SaveGolden(golden, old); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadGolden(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded) != len(old) {
+		t.Fatalf("LoadGolden produced %#v instead of %#v", loaded, old)
+	}
+	for i, e := range loaded {
+		if e.String() != old[i].String() {
+			t.Errorf("LoadGolden produced %#v instead of %#v", e.String(), old[i].String())
+		}
+	}
+	if diffs := CompareGolden(loaded, old); len(diffs) != 0 {
+		t.Errorf("CompareGolden of identical entries produced %#v", diffs)
+	}
+	writeFilesIn(t, dir, map[string]string{"a.b": "k > ch / _(e|a)\n"})
+	words = append(words[1:], Word{Text: "pum"})
+	new, err := NewCache().GoldenFiles(words, files...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	diffs := CompareGolden(loaded, new)
+	expected := []struct {
+		kind   DiffKind
+		word   string
+		gained []string
+		lost   []string
+	}{
+		{DiffChanged, "kalum", []string{"k > ch / _(e|a)"}, nil},
+		{DiffAdded, "pum", nil, nil},
+		{DiffRemoved, "kentum", nil, nil},
+	}
+	if len(diffs) != len(expected) {
+		t.Fatalf("CompareGolden produced %#v", diffs)
+	}
+	for i, d := range diffs {
+		e := expected[i]
+		word := d.New.Word.Text
+		if d.Kind == DiffRemoved {
+			word = d.Old.Word.Text
+		}
+		gained, lost := goldenRules(d)
+		if d.Kind != e.kind || word != e.word || !stringSliceEqual(gained, e.gained) || !stringSliceEqual(lost, e.lost) {
+			t.Errorf("CompareGolden produced %#v instead of %#v", d, e)
+		}
+	}
+	// an edit to a category is blamed on the rule whose output it changed
+	writeFilesIn(t, dir, map[string]string{"c": "V = u\n{V} > o\nm > n / _#\n"})
+	words = []Word{{Text: "dentum"}}
+	old, err = NewCache().GoldenFiles(words, filepath.Join(dir, "c"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFilesIn(t, dir, map[string]string{"c": "V = u e\n{V} > o\nm > n / _#\n"})
+	new, err = NewCache().GoldenFiles(words, filepath.Join(dir, "c"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	diffs = CompareGolden(old, new)
+	if len(diffs) != 1 {
+		t.Fatalf("CompareGolden produced %#v", diffs)
+	}
+	gained, lost := goldenRules(diffs[0])
+	if !stringSliceEqual(gained, []string{"{V} > o"}) || !stringSliceEqual(lost, []string{"{V} > o"}) || diffs[0].Gained[0].Output != "dontom" || diffs[0].Lost[0].Output != "dentom" {
+		t.Errorf("CompareGolden produced %#v", diffs[0])
+	}
+}
+
+// goldenRules returns the text of the rules a word gained and lost in a diff
+func goldenRules(d GoldenDiff) (gained, lost []string) {
+	for _, st := range d.Gained {
+		gained = append(gained, st.Text)
+	}
+	for _, s := range d.Lost {
+		lost = append(lost, s.Rule)
+	}
+	return gained, lost
+}
+
+func TestParseRevisions(t *testing.T) {
+	tables := []struct {
+		revisions string
+		old, new  string
+		err       bool
+	}{
+		{"HEAD~1..HEAD", "HEAD~1", "HEAD", false},
+		{"main", "main", "", false},
+		{"main...HEAD", "", "", true},
+		{"..HEAD", "", "", true},
+	}
+	for _, tab := range tables {
+		old, new, err := ParseRevisions(tab.revisions)
+		switch {
+		case tab.err && err == nil:
+			t.Errorf("ParseRevisions(%#v) failed to produce an error", tab.revisions)
+		case !tab.err && err != nil:
+			t.Errorf("ParseRevisions(%#v) incorrectly produced the error %v", tab.revisions, err)
+		case old != tab.old || new != tab.new:
+			t.Errorf("ParseRevisions(%#v) produced %#v and %#v instead of %#v and %#v", tab.revisions, old, new, tab.old, tab.new)
+		}
+	}
+}
+
+func TestRevisionCache(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v\n%s", args, err, out)
+		}
+	}
+	file := filepath.Join(dir, "a")
+	manifest := filepath.Join(dir, "tree")
+	romanized := filepath.Join(dir, "r")
+	git("init", "-q")
+	writeFilesIn(t, dir, map[string]string{
+		"a":    "k > c / _e\n",
+		"tree": "proto\na < proto : a\n",
+		"r":    "@romanize-file orth\n",
+		"orth": "e > é\n",
+	})
+	git("add", ".")
+	git("commit", "-q", "-m", "first")
+	writeFilesIn(t, dir, map[string]string{"a": "k > ch / _e\n", "orth": "e > ë\n"})
+	tables := []struct {
+		cache           *Cache
+		output, spelled string
+	}{
+		{NewCache(), "chento", "kënto"},
+		{NewRevisionCache("HEAD"), "cento", "kénto"},
+	}
+	for _, tab := range tables {
+		if output, _, err := tab.cache.ApplyFiles("kento", file); err != nil || output != tab.output {
+			t.Errorf("ApplyFiles produced %#v and %v instead of %#v", output, err, tab.output)
+		}
+		tree, err := tab.cache.LoadTree(manifest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files, err := tree.Descent("proto", "a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if output, _, err := tab.cache.ApplyFiles("kento", files...); err != nil || output != tab.output {
+			t.Errorf("ApplyFiles through the tree produced %#v and %v instead of %#v", output, err, tab.output)
+		}
+		if res, err := tab.cache.ApplyChain(Word{Text: "kento"}, romanized); err != nil || res.Spelled.Text != tab.spelled {
+			t.Errorf("ApplyChain with an orthography file produced %#v and %v instead of %#v", res.Spelled.Text, err, tab.spelled)
+		}
+	}
+	if _, err := NewRevisionCache("HEAD").LoadFile(filepath.Join(dir, "b")); err == nil {
+		t.Errorf("LoadFile of a file missing from the revision failed to produce an error")
+	}
+	if _, err := NewRevisionCache("--output=" + filepath.Join(dir, "out")).LoadFile(file); err == nil {
+		t.Errorf("LoadFile at a revision starting with `-` failed to produce an error")
+	}
+}
+
+func TestUnapplyFiles(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"a":   "s > h ; persist=chain\n",
+		"a.b": "z > s\nV = a e\n{V} > e / _#\n",
+	})
+	files, err := PairFiles(dir+"/", "", ".a.b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	words, err := NewCache().UnapplyFiles(Word{Text: "ahe"}, files...)
+	candidates := make([]string, len(words))
+	for i, w := range words {
+		candidates[i] = w.Text
+	}
+	expected := []string{"aha", "ahe", "asa", "ase", "aza", "aze"}
+	switch {
+	case err != nil:
+		t.Errorf("UnapplyFiles incorrectly produced the error %v", err)
+	case !stringSliceEqual(candidates, expected):
+		t.Errorf("UnapplyFiles produced %#v instead of %#v", candidates, expected)
+	}
+}
+
+func TestTree(t *testing.T) {
+	lines := []string{
+		"// a small tree",
+		"pie",
+		"\tname = Proto-Indo-European",
+		"\tdate = -4000",
+		"latin < pie : latin.sc",
+		"lat.vulg < latin : vulgar.sc",
+		"  name = Vulgar Latin",
+		"french < lat.vulg : french.sc",
+		"spanish < lat.vulg : spanish.sc",
+		"greek < pie : greek.sc",
+		"basque : basque.sc",
+	}
+	tree := NewTree()
+	for _, l := range lines {
+		if err := tree.ParseLine(l); err != nil {
+			t.Fatalf("ParseLine(%#v) produced the error %v", l, err)
+		}
+	}
+	if n := tree.Nodes["pie"]; n.DisplayName() != "Proto-Indo-European" || n.Metadata["date"] != "-4000" {
+		t.Errorf("node pie has the metadata %#v", n.Metadata)
+	}
+	if n := tree.Nodes["french"]; n.DisplayName() != "french" || n.Parent != tree.Nodes["lat.vulg"] {
+		t.Errorf("node french is %#v", n)
+	}
+	if len(tree.Roots) != 2 || len(tree.Nodes["lat.vulg"].Children) != 2 {
+		t.Errorf("tree has roots %v, and lat.vulg has children %v", tree.Roots, tree.Nodes["lat.vulg"].Children)
+	}
+	tables := []struct {
+		from, to string
+		up, down []string
+		err      bool
+	}{
+		{
+			from: "",
+			to:   "french",
+			up:   []string{},
+			down: []string{"latin.sc", "vulgar.sc", "french.sc"},
+			err:  false,
+		},
+		{
+			from: "french",
+			to:   "spanish",
+			up:   []string{"french.sc"},
+			down: []string{"spanish.sc"},
+			err:  false,
+		},
+		{
+			from: "greek",
+			to:   "lat.vulg",
+			up:   []string{"greek.sc"},
+			down: []string{"latin.sc", "vulgar.sc"},
+			err:  false,
+		},
+		{
+			from: "french",
+			to:   "basque",
+			up:   nil,
+			down: nil,
+			err:  true,
+		},
+		{
+			from: "latin",
+			to:   "italian",
+			up:   nil,
+			down: nil,
+			err:  true,
+		},
+	}
+	for _, tab := range tables {
+		_, up, down, err := tree.Route(tab.from, tab.to)
+		switch {
+		case tab.err && err == nil:
+			t.Errorf("Route(%#v, %#v) failed to produce an error", tab.from, tab.to)
+		case !tab.err && err != nil:
+			t.Errorf("Route(%#v, %#v) incorrectly produced the error %v", tab.from, tab.to, err)
+		case !tab.err && err == nil:
+			if !stringSliceEqual(up, tab.up) || !stringSliceEqual(down, tab.down) {
+				t.Errorf("Route(%#v, %#v) produced %#v and %#v instead of %#v and %#v", tab.from, tab.to, up, down, tab.up, tab.down)
+			}
+		}
+	}
+	if _, err := tree.Descent("french", "spanish"); err == nil {
+		t.Errorf("Descent(%#v, %#v) failed to produce an error", "french", "spanish")
+	}
+	for _, l := range []string{"\tkey = value", "italian < vulgar", "a b c"} {
+		if err := NewTree().ParseLine(l); err == nil {
+			t.Errorf("ParseLine(%#v) failed to produce an error", l)
+		}
+	}
+	if err := tree.ParseLine("latin"); err == nil {
+		t.Errorf("ParseLine(%#v) failed to produce an error for a duplicate node", "latin")
+	}
+}
+
+func TestApplyTree(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"tree":         "proto\na.1 < proto : rules/a.1.sc\nb < proto : rules/b.sc\n",
+		"rules/a.1.sc": "p > f\n",
+		"rules/b.sc":   "p > b\n",
+	})
+	c := NewCache()
+	tree, err := c.LoadTree(filepath.Join(dir, "tree"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := tree.Descent("proto", "a.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output, _, err := c.ApplyFiles("pa", files...); err != nil || output != "fa" {
+		t.Errorf("ApplyFiles produced %#v and %v instead of %#v", output, err, "fa")
+	}
+	above, up, down, err := tree.Route("b", "a.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cognates, err := c.ApplyRoute(Word{Text: "ba"}, above, up, down)
+	if err != nil || len(cognates) != 2 || cognates[0].Phonemic.Text != "ba" || cognates[1].Phonemic.Text != "fa" {
+		t.Errorf("ApplyRoute produced %#v and %v", cognates, err)
+	}
+}
+
+func TestScanTree(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"latin":                        "",
+		"latin.ecclesiastical":         "",
+		"latin.vulgar":                 "",
+		"latin.vulgar.iberian.spanish": "",
+		".hidden":                      "",
+		"latin~":                       "",
+		"latin..french":                "",
+		"#latin.vulgar#":               "",
+	})
+	tree, err := ScanTree(dir + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	missing := []string{"latin.vulgar.iberian"}
+	if m := tree.Missing(); !stringSliceEqual(m, missing) {
+		t.Errorf("Missing() produced %#v instead of %#v", m, missing)
+	}
+	ascii := "latin\n" +
+		"|-- latin.ecclesiastical\n" +
+		"`-- latin.vulgar\n" +
+		"    `-- latin.vulgar.iberian [missing]\n" +
+		"        `-- latin.vulgar.iberian.spanish\n"
+	if out := tree.ASCII(); out != ascii {
+		t.Errorf("ASCII() produced\n%s\ninstead of\n%s", out, ascii)
+	}
+	dot := "digraph tree {\n" +
+		"\t\"latin\" [label=\"latin\"];\n" +
+		"\t\"latin\" -> \"latin.ecclesiastical\";\n" +
+		"\t\"latin.ecclesiastical\" [label=\"latin.ecclesiastical\"];\n" +
+		"\t\"latin\" -> \"latin.vulgar\";\n" +
+		"\t\"latin.vulgar\" [label=\"latin.vulgar\"];\n" +
+		"\t\"latin.vulgar\" -> \"latin.vulgar.iberian\";\n" +
+		"\t\"latin.vulgar.iberian\" [label=\"latin.vulgar.iberian\" style=dashed];\n" +
+		"\t\"latin.vulgar.iberian\" -> \"latin.vulgar.iberian.spanish\";\n" +
+		"\t\"latin.vulgar.iberian.spanish\" [label=\"latin.vulgar.iberian.spanish\"];\n" +
+		"}\n"
+	if out := tree.DOT(); out != dot {
+		t.Errorf("DOT() produced\n%s\ninstead of\n%s", out, dot)
+	}
+}
+
+func TestApplyDescendants(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"tree": "proto\nwest < proto : west\nwest.a < west : a\nwest.b < west : b\neast < proto\n",
+		"west": "@deromanize c > k\nk > tʃ / _i ; persist=chain\n",
+		"a":    "e > i\n@romanize tʃ > ch\n",
+		"b":    "a > o\n",
+	})
+	c := NewCache()
+	tree, err := c.LoadTree(filepath.Join(dir, "tree"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reflexes, err := c.ApplyDescendants(Word{Text: "cea"}, tree, "proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []struct {
+		name, phonemic, spelled string
+	}{
+		{"west", "kea", "kea"},
+		{"west.a", "tʃia", "chia"},
+		{"west.b", "keo", "keo"},
+		{"east", "cea", "cea"},
+	}
+	if len(reflexes) != len(expected) {
+		t.Fatalf("ApplyDescendants produced %#v", reflexes)
+	}
+	for i, r := range reflexes {
+		e := expected[i]
+		if r.Node.Name != e.name || r.Phonemic.Text != e.phonemic || r.Spelled.Text != e.spelled {
+			t.Errorf("ApplyDescendants produced %v %#v %#v instead of %v %#v %#v", r.Node.Name, r.Phonemic.Text, r.Spelled.Text, e.name, e.phonemic, e.spelled)
+		}
+		files, _ := tree.Descent("proto", r.Node.Name)
+		res, err := c.ApplyChain(Word{Text: "cea"}, files...)
+		if err != nil || res.Phonemic.Text != r.Phonemic.Text || res.Spelled.Text != r.Spelled.Text {
+			t.Errorf("ApplyChain for %v produced %#v %#v instead of %#v %#v", r.Node.Name, res.Phonemic.Text, res.Spelled.Text, r.Phonemic.Text, r.Spelled.Text)
+		}
+	}
+}
+
+func TestApplyDescendantsInherited(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"tree":  "proto : proto\nwest < proto\nwest.a < west : a\nwest.b < west : b\n",
+		"proto": "@deromanize c > k\nk > tʃ / _i ; persist=chain\n",
+		"a":     "@deromanize q > k\ne > i\n",
+		"b":     "@deromanize q > k\na > o\n",
+	})
+	c := NewCache()
+	tree, err := c.LoadTree(filepath.Join(dir, "tree"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the word is already in the phonemic form of west, so the persistent
+	// rule of proto applies, and so does the deromanizer of the first file
+	// below west, but not that of proto
+	reflexes, err := c.ApplyDescendants(Word{Text: "qec"}, tree, "west")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []struct {
+		name, phonemic string
+	}{
+		{"west.a", "tʃic"},
+		{"west.b", "kec"},
+	}
+	if len(reflexes) != len(expected) {
+		t.Fatalf("ApplyDescendants produced %#v", reflexes)
+	}
+	for i, r := range reflexes {
+		e := expected[i]
+		if r.Node.Name != e.name || r.Phonemic.Text != e.phonemic {
+			t.Errorf("ApplyDescendants produced %v %#v instead of %v %#v", r.Node.Name, r.Phonemic.Text, e.name, e.phonemic)
+		}
+	}
+}
+
+func TestApplyFile(t *testing.T) {
+	tables := []struct {
+		word   string
+		output string
+		err    bool
+	}{
+		{
+			word:   "bp",
+			output: "pp",
+			err:    false,
+		},
+		{
+			word:   "mbp",
+			output: "mbp",
+			err:    false,
+		},
+		{
+			word:   "abadega",
+			output: "awaeɣa",
+			err:    false,
+		},
+		{
+			word:   "abadegam",
+			output: "amaeŋam",
+			err:    false,
+		},
+	}
+	filename := "test_sc"
+	rl, err := LoadFile(filename)
+	if err != nil {
+		t.Fatalf("LoadFile(%#v) incorrectly produced the error %#v", filename, err)
+	}
+	for _, tab := range tables {
+		output, _, err := rl.Apply(tab.word)
+		switch {
+		case tab.err && err == nil:
+			t.Errorf("Apply(%#v) failed to produce an error", tab.word)
+		case !tab.err && err != nil:
+			t.Errorf("Apply(%#v) incorrectly produced the error %v", tab.word, err)
+		case !tab.err && err == nil:
+			if tab.output != output {
+				t.Errorf("Apply(%#v) produced the output %#v instead of %#v", tab.word, output, tab.output)
+			}
+		}
+	}
+}
+
+func TestRoute(t *testing.T) {
+	tables := []struct {
+		from, to        string
+		above, up, down []string
+		err             bool
+	}{
+		{
+			from:  "a.b.c",
+			to:    "a.b.d.e",
+			above: []string{"a", "a.b"},
+			up:    []string{"a.b.c"},
+			down:  []string{"a.b.d", "a.b.d.e"},
+			err:   false,
+		},
+		{
+			from:  "a.b",
+			to:    ".c",
+			above: []string{"a", "a.b"},
+			up:    []string{},
+			down:  []string{"a.b.c"},
+			err:   false,
+		},
+		{
+			from:  "a.b.c",
+			to:    "a",
+			above: []string{"a"},
+			up:    []string{"a.b", "a.b.c"},
+			down:  []string{},
+			err:   false,
+		},
+		{
+			from:  "",
+			to:    "a.b",
+			above: []string{},
+			up:    []string{},
+			down:  []string{"a", "a.b"},
+			err:   false,
+		},
+		{
+			from:  "a.b",
+			to:    "c.d",
+			above: nil,
+			up:    nil,
+			down:  nil,
+			err:   true,
+		},
+		{
+			from:  "a..b",
+			to:    "a.c",
+			above: nil,
+			up:    nil,
+			down:  nil,
+			err:   true,
+		},
+		{
+			from:  "a",
+			to:    ".b~",
+			above: nil,
+			up:    nil,
+			down:  nil,
+			err:   true,
+		},
+	}
+	for _, tab := range tables {
+		above, up, down, err := Route(tab.from, tab.to)
+		switch {
+		case tab.err && err == nil:
+			t.Errorf("Route(%#v, %#v) failed to produce an error", tab.from, tab.to)
+		case !tab.err && err != nil:
+			t.Errorf("Route(%#v, %#v) incorrectly produced the error %v", tab.from, tab.to, err)
+		case !tab.err && err == nil:
+			if !stringSliceEqual(above, tab.above) || !stringSliceEqual(up, tab.up) || !stringSliceEqual(down, tab.down) {
+				t.Errorf("Route(%#v, %#v) produced %#v, %#v and %#v instead of %#v, %#v and %#v", tab.from, tab.to, above, up, down, tab.above, tab.up, tab.down)
+			}
+		}
+	}
+}
+
+// routeCognates follows the route between two names, using a prefix for all
+// filenames
+func routeCognates(t *testing.T, c *Cache, word Word, prefix, from, to string) ([]Cognate, error) {
+	above, up, down, err := Route(from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c.ApplyRoute(word, prefixSlice(above, prefix), prefixSlice(up, prefix), prefixSlice(down, prefix))
+}
+
+func TestApplyRoute(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"a":     "@romanize s > ss\n",
+		"a.b":   "V = a e\n{V} > e / _#\n",
+		"a.c":   "a > o\n",
+		"a.c.d": "@romanize o > ô\n",
+	})
+	c := NewCache()
+	cognates, err := routeCognates(t, c, Word{Text: "se"}, dir+"/", "a.b", "a.c.d")
+	expected := []Cognate{
+		{Ancestor: Word{Text: "sa"}, Phonemic: Word{Text: "so"}, Spelled: Word{Text: "sô"}},
+		{Ancestor: Word{Text: "se"}, Phonemic: Word{Text: "se"}, Spelled: Word{Text: "se"}},
+	}
+	if err != nil {
+		t.Fatalf("ApplyRoute incorrectly produced the error %v", err)
+	}
+	if len(cognates) != len(expected) {
+		t.Fatalf("ApplyRoute produced %#v instead of %#v", cognates, expected)
+	}
+	for i, cog := range cognates {
+		e := expected[i]
+		if cog.Ancestor.Text != e.Ancestor.Text || cog.Phonemic.Text != e.Phonemic.Text || cog.Spelled.Text != e.Spelled.Text {
+			t.Errorf("ApplyRoute produced %#v instead of %#v", cog, e)
+		}
+	}
+}
+
+func TestApplyRouteInherited(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"a":   "k > tʃ / _i ; persist=chain\n",
+		"a.b": "e > i\n",
+		"a.c": "e > i / _#\n",
+	})
+	c := NewCache()
+	cognates, err := routeCognates(t, c, Word{Text: "tʃi"}, dir+"/", "a.b", "a.c")
+	if err != nil {
+		t.Fatalf("ApplyRoute incorrectly produced the error %v", err)
+	}
+	expected := []Cognate{
+		{Ancestor: Word{Text: "ke"}, Phonemic: Word{Text: "tʃi"}},
+		{Ancestor: Word{Text: "tʃe"}, Phonemic: Word{Text: "tʃi"}},
+		{Ancestor: Word{Text: "tʃi"}, Phonemic: Word{Text: "tʃi"}},
+	}
+	if len(cognates) != len(expected) {
+		t.Fatalf("ApplyRoute produced %#v instead of %#v", cognates, expected)
+	}
+	for i, cog := range cognates {
+		e := expected[i]
+		if cog.Ancestor.Text != e.Ancestor.Text || cog.Phonemic.Text != e.Phonemic.Text {
+			t.Errorf("ApplyRoute produced %#v instead of %#v", cog, e)
+		}
+	}
+}
+
 func TestPairs(t *testing.T) {
 	tables := []struct {
 		names  []string
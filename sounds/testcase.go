@@ -0,0 +1,150 @@
+package sounds
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/zyxw59/conlang/transcription"
+)
+
+// A TestCase is an expected input and output declared in a sound change file
+// by a `@test` or `@test-chain` directive
+type TestCase struct {
+	Input, Output string
+	// Chain is whether the test is of the whole chain of files leading to
+	// the file, rather than the file on its own
+	Chain bool
+	// Line is the line of the file the test was declared on
+	Line int
+	// scheme is the transcription scheme the test was written in, or nil
+	// if it was written in the IPA
+	scheme *transcription.Scheme
+}
+
+// A TestResult is the result of running a TestCase
+type TestResult struct {
+	TestCase
+	// File is the file the test was declared in, and Files are the files
+	// it was run through
+	File  string
+	Files []string
+	// Got is the output of the files, and Trace is the trace of the rules
+	// applied to produce it
+	Got   string
+	Trace Trace
+	// Err is the error produced by applying the files, if any
+	Err error
+}
+
+// Passed reports whether the test produced its expected output
+func (r TestResult) Passed() bool {
+	return r.Err == nil && r.Got == r.Output
+}
+
+// parseTest parses the arguments of a test directive, which are an input and
+// an output separated by `=>`
+func (rl *RuleList) parseTest(args string, chain bool) error {
+	split := strings.SplitN(args, teststr, 2)
+	if len(split) < 2 || strings.TrimSpace(split[0]) == "" {
+		return fmt.Errorf("directive error: `%s` is not a valid test", args)
+	}
+	rl.tests = append(rl.tests, TestCase{
+		Input:  strings.TrimSpace(split[0]),
+		Output: strings.TrimSpace(split[1]),
+		Chain:  chain,
+		Line:   rl.lineCount,
+		scheme: rl.settings.scheme,
+	})
+	return nil
+}
+
+// Tests returns the test cases declared in the RuleList
+func (rl *RuleList) Tests() []TestCase {
+	return rl.tests
+}
+
+// TestFiles runs the tests declared in each of a series of files. The chain
+// of each file is the list of files leading to it, which a `@test-chain` is
+// run through. A `@test` is run through its file alone. Words are
+// deromanized and romanized as for ApplyFiles. A test declared after a
+// `@transcription` directive is written in its scheme, so its input is
+// converted to the IPA unless it is deromanized, and the output is converted
+// back unless it is romanized
+func (c *Cache) TestFiles(files []string, chains [][]string) ([]TestResult, error) {
+	var results []TestResult
+	for i, file := range files {
+		rl, err := c.LoadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		for _, tc := range rl.Tests() {
+			res := TestResult{TestCase: tc, File: file, Files: []string{file}}
+			if tc.Chain {
+				res.Files = chains[i]
+			}
+			rls, err := c.LoadFiles(res.Files...)
+			if err != nil {
+				return nil, err
+			}
+			input := tc.Input
+			if tc.scheme != nil && rls[0].deromanizer == nil {
+				input = tc.scheme.ToIPA(input)
+			}
+			var out ChainResult
+			out, res.Err = c.ApplyChain(Word{Text: input}, res.Files...)
+			res.Got, res.Trace = out.Spelled.Text, out.Trace
+			if tc.scheme != nil && rls[len(rls)-1].romanizer == nil {
+				res.Got = tc.scheme.FromIPA(res.Got)
+			}
+			results = append(results, res)
+		}
+	}
+	return results, nil
+}
+
+// TestPairs runs the tests declared in a series of sound change files, using
+// a prefix for all filenames, as described for TestFiles. The chain of each
+// file runs from the root of the language tree, so the chain of
+// `latin.vulgar` is `latin` and `latin.vulgar`
+func (c *Cache) TestPairs(prefix string, names ...string) ([]TestResult, error) {
+	pairs, err := Pairs(names...)
+	if err != nil {
+		return nil, err
+	}
+	chains := make([][]string, len(pairs))
+	for i, name := range pairs {
+		chain, err := Pairs("", "."+name)
+		if err != nil {
+			return nil, err
+		}
+		chains[i] = prefixSlice(chain, prefix)
+	}
+	return c.TestFiles(prefixSlice(pairs, prefix), chains)
+}
+
+// TestTree runs the tests declared in the files leading down a tree from one
+// node to another, as described for TestFiles. The chain of each file runs
+// from the root of the tree
+func (c *Cache) TestTree(tree *Tree, from, to string) ([]TestResult, error) {
+	if _, err := tree.Descent(from, to); err != nil {
+		return nil, err
+	}
+	_, _, down, err := tree.route(from, to)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	var chains [][]string
+	for _, n := range down {
+		if n.File == "" {
+			continue
+		}
+		chain, err := tree.Descent("", n.Name)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, n.File)
+		chains = append(chains, chain)
+	}
+	return c.TestFiles(files, chains)
+}
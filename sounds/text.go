@@ -0,0 +1,233 @@
+package sounds
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// A Text is a piece of running text, split into words and the separators
+// (whitespace and punctuation) between them. There is always one more
+// separator than there are words: the first separator comes before the first
+// word, and the last comes after the last word. Either may be empty
+type Text struct {
+	Words []string
+	Seps  []string
+}
+
+// ParseText splits a string into words and separators. A word is a maximal
+// run of letters and combining marks, and everything else is a separator.
+// Which separators actually divide words depends on the boundary directive of
+// the rules applied to the text, as described for applyRule
+func ParseText(s string) Text {
+	t := Text{}
+	start := 0
+	inWord := false
+	for i, r := range s {
+		if isWordRune(r) != inWord {
+			if inWord {
+				t.Words = append(t.Words, s[start:i])
+			} else {
+				t.Seps = append(t.Seps, s[start:i])
+			}
+			start = i
+			inWord = !inWord
+		}
+	}
+	if inWord {
+		t.Words = append(t.Words, s[start:])
+		t.Seps = append(t.Seps, "")
+	} else {
+		t.Seps = append(t.Seps, s[start:])
+	}
+	return t
+}
+
+// singleWord returns a Text consisting of a single word, with no separators
+func singleWord(word string) Text {
+	return Text{Words: []string{word}, Seps: []string{"", ""}}
+}
+
+// isWordRune reports whether a rune can be part of a word
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsMark(r)
+}
+
+// String reassembles the text from its words and separators
+func (t Text) String() string {
+	parts := make([]string, 0, len(t.Words)+len(t.Seps))
+	for i, w := range t.Words {
+		parts = append(parts, t.Seps[i], w)
+	}
+	parts = append(parts, t.Seps[len(t.Seps)-1])
+	return strings.Join(parts, "")
+}
+
+// Equal compares two Texts by value
+func (t Text) Equal(other Text) bool {
+	return stringSliceEqual(t.Words, other.Words) && stringSliceEqual(t.Seps, other.Seps)
+}
+
+// withWords returns a copy of the text with its words replaced
+func (t Text) withWords(words []string) Text {
+	return Text{Words: words, Seps: t.Seps}
+}
+
+// wordJoiners matches the characters which join the parts of a word, such as
+// the hyphen of a compound or the apostrophe of an elision, unless a boundary
+// directive makes them boundaries instead
+var wordJoiners = regexp.MustCompile(fmt.Sprintf("^(?:%s|%s)$", boundaryClasses["hyphen"], boundaryClasses["apostrophe"]))
+
+// isBoundary reports whether a character separates words for a rule
+func (cr *CompiledRule) isBoundary(r rune) bool {
+	if cr.boundary == nil {
+		return unicode.IsSpace(r)
+	}
+	return cr.boundary.MatchString(string(r))
+}
+
+// joins reports whether a rule treats the words on either side of a separator
+// as one, because the separator is empty, or consists only of hyphens and
+// apostrophes which are not boundaries. For a sandhi rule, a separator which
+// consists only of boundaries also joins the words on either side, so that `#`
+// matches between them
+func (cr *CompiledRule) joins(sep string) bool {
+	if sep == "" {
+		return true
+	}
+	joiner, boundary := true, true
+	for _, r := range sep {
+		b := cr.isBoundary(r)
+		joiner = joiner && !b && wordJoiners.MatchString(string(r))
+		boundary = boundary && b
+	}
+	return joiner || cr.Sandhi && boundary
+}
+
+// units returns the start and end indices of the runs of words which a rule
+// is applied to as a whole, which are those joined by the separators between
+// them, as described for joins
+func (t Text) units(cr *CompiledRule) [][2]int {
+	var units [][2]int
+	start := 0
+	for i := 1; i < len(t.Words); i++ {
+		if !cr.joins(t.Seps[i]) {
+			units = append(units, [2]int{start, i})
+			start = i
+		}
+	}
+	if len(t.Words) > 0 {
+		units = append(units, [2]int{start, len(t.Words)})
+	}
+	return units
+}
+
+// applyRule applies a rule to a text, and returns the places the rule
+// matched, and the spans of the output which replaced them, as byte offsets
+// into the input and output texts. The rule is applied to each run of words
+// joined by the separators between them, as described for units, with the
+// separators left in place, so that `#` matches between the words of a sandhi
+// rule. The output of each run is split back into words and separators at the
+// places the edges of the words were moved to, as described for mapOffset, so
+// that a rule may rewrite the separators without changing the number of words
+func applyRule(cr *CompiledRule, text Text, tags Tags) (Text, []Match, [][2]int, error) {
+	input := text.String()
+	starts := wordStarts(text)
+	output := Text{
+		Words: append([]string(nil), text.Words...),
+		Seps:  append([]string(nil), text.Seps...),
+	}
+	var (
+		allMatches []Match
+		allSpans   [][2]int
+	)
+	// shift is how much longer the output is than the input, before the
+	// current unit
+	shift := 0
+	for _, u := range text.units(cr) {
+		start := starts[u[0]]
+		end := starts[u[1]-1] + len(text.Words[u[1]-1])
+		out, matches, spans, err := cr.applyMatches(input[start:end], tags)
+		if err != nil {
+			return text, nil, nil, err
+		}
+		if len(matches) == 0 {
+			continue
+		}
+		prev := 0
+		for i := u[0]; i < u[1]; i++ {
+			wordStart := starts[i] - start
+			wordEnd := wordStart + len(text.Words[i])
+			outStart := mapOffset(matches, spans, wordStart, false)
+			if outStart < prev {
+				outStart = prev
+			}
+			outEnd := mapOffset(matches, spans, wordEnd, true)
+			if i > u[0] {
+				output.Seps[i] = out[prev:outStart]
+			}
+			output.Words[i] = out[outStart:outEnd]
+			prev = outEnd
+		}
+		for i, m := range matches {
+			allMatches = append(allMatches, Match{Start: start + m.Start, End: start + m.End, Indices: m.Indices})
+			allSpans = append(allSpans, [2]int{start + shift + spans[i][0], start + shift + spans[i][1]})
+		}
+		shift += len(out) - (end - start)
+	}
+	return output, allMatches, allSpans, nil
+}
+
+// mapOffset converts a byte offset into the input of a rule to one into its
+// output, given the places the rule matched and the spans which replaced them.
+// An offset inside a match is moved to the end of its replacement if end is
+// set, and to its start otherwise. Likewise, text inserted at the offset comes
+// before it if end is set, and after it otherwise, so that insertions at
+// either edge of a word become part of the word
+func mapOffset(matches []Match, spans [][2]int, x int, end bool) int {
+	shift := 0
+	for i, m := range matches {
+		switch {
+		case m.End < x || m.End == x && (m.Start < x || end):
+			shift = spans[i][1] - m.End
+		case m.Start < x:
+			if end {
+				return spans[i][1]
+			}
+			return spans[i][0]
+		default:
+			return x + shift
+		}
+	}
+	return x + shift
+}
+
+// applyLine applies a line of a RuleList to a text, and returns the step
+// recording it, without its position in the file
+func applyLine(l Applier, text Text, tags Tags) (Text, Step, error) {
+	step := Step{Kind: stepKind(l), Input: text.String()}
+	if cr, ok := l.(*CompiledRule); ok {
+		output, matches, spans, err := applyRule(cr, text, tags)
+		step.Text, step.Output = cr.String(), output.String()
+		step.Matches, step.Replacements = matches, spans
+		return output, step, err
+	}
+	step.Output = step.Input
+	if len(text.Words) == 0 {
+		_, debug, err := l.Apply("")
+		step.Text = debug
+		return text, step, err
+	}
+	words := make([]string, len(text.Words))
+	var err error
+	for i, w := range text.Words {
+		words[i], step.Text, err = l.Apply(w)
+		if err != nil {
+			return text, step, err
+		}
+	}
+	output := text.withWords(words)
+	step.Output = output.String()
+	return output, step, nil
+}
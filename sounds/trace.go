@@ -0,0 +1,180 @@
+package sounds
+
+// A StepKind is the kind of a Step in a Trace
+type StepKind string
+
+// The kinds of Steps. A file step marks the start of a file in a chain, and
+// deromanize and romanize steps are the orthographies of a chain being applied
+const (
+	StepRule       StepKind = "rule"
+	StepComment    StepKind = "comment"
+	StepCategory   StepKind = "category"
+	StepDirective  StepKind = "directive"
+	StepLine       StepKind = "line"
+	StepFile       StepKind = "file"
+	StepDeromanize StepKind = "deromanize"
+	StepRomanize   StepKind = "romanize"
+)
+
+// A Step records one line of a sound change file being applied to a text
+type Step struct {
+	Kind StepKind `json:"kind"`
+	// File is the name of the file the line is from, if known
+	File string `json:"file,omitempty"`
+	// Line is the line number of the line in its file, counting from 1,
+	// or 0 if it is not known
+	Line int `json:"line,omitempty"`
+	// Text is the line as it was parsed
+	Text   string `json:"text,omitempty"`
+	Input  string `json:"input"`
+	Output string `json:"output"`
+	// Matches are the places the rule matched, as byte offsets into the
+	// input, with the index of the element matched by each numbered
+	// category
+	Matches []Match `json:"matches,omitempty"`
+	// Replacements are the spans of the output which replaced each match,
+	// as byte offsets into the output
+	Replacements [][2]int `json:"replacements,omitempty"`
+	// Persistent is whether the step is a persistent rule being
+	// re-applied after a later line
+	Persistent bool `json:"persistent,omitempty"`
+}
+
+// Changed reports whether the step changed the text
+func (s Step) Changed() bool {
+	return s.Input != s.Output
+}
+
+// String returns the step as a line of debugging output
+func (s Step) String() string {
+	switch s.Kind {
+	case StepRule:
+		return s.Text + "  " + s.Output
+	case StepFile:
+		return s.File
+	case StepDeromanize, StepRomanize:
+		return string(s.Kind) + "  " + s.Output
+	}
+	return s.Text
+}
+
+// A Trace is the record of the lines of one or more sound change files being
+// applied to a text, in order
+type Trace []Step
+
+// Strings returns the debugging output for the trace, with one string for
+// each step
+func (t Trace) Strings() []string {
+	out := make([]string, len(t))
+	for i, s := range t {
+		out[i] = s.String()
+	}
+	return out
+}
+
+// Fired returns the steps of the trace in which a rule matched the text
+func (t Trace) Fired() Trace {
+	var out Trace
+	for _, s := range t {
+		if s.Kind == StepRule && len(s.Matches) > 0 {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// Changed returns the steps of the trace which changed the text
+func (t Trace) Changed() Trace {
+	var out Trace
+	for _, s := range t {
+		if s.Changed() {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// Sections returns the steps of the trace which changed the text, with each
+// preceded by the start of its file and the last comment before it, as
+// headings. Each heading is included at most once, and only if some step
+// under it changed the text
+func (t Trace) Sections() Trace {
+	var (
+		out           Trace
+		file, comment *Step
+	)
+	for i, s := range t {
+		switch {
+		case s.Kind == StepFile:
+			file, comment = &t[i], nil
+		case s.Kind == StepComment:
+			comment = &t[i]
+		case s.Changed():
+			if file != nil {
+				out = append(out, *file)
+				file = nil
+			}
+			if comment != nil {
+				out = append(out, *comment)
+				comment = nil
+			}
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// lineNumber returns the line number of the i-th line of the RuleList in its
+// file, or 0 if it is not known
+func (rl *RuleList) lineNumber(i int) int {
+	if i < len(rl.lineNumbers) {
+		return rl.lineNumbers[i]
+	}
+	return 0
+}
+
+// addLine adds a line to the RuleList, recording its line number
+func (rl *RuleList) addLine(l Applier) {
+	rl.Lines = append(rl.Lines, l)
+	rl.lineNumbers = append(rl.lineNumbers, rl.lineCount)
+}
+
+// wordStarts returns the byte offset of each word in the text
+func wordStarts(text Text) []int {
+	starts := make([]int, len(text.Words))
+	pos := 0
+	for i, w := range text.Words {
+		pos += len(text.Seps[i])
+		starts[i] = pos
+		pos += len(w)
+	}
+	return starts
+}
+
+// stepKind returns the kind of step for a line of a RuleList
+func stepKind(l Applier) StepKind {
+	switch l.(type) {
+	case *CompiledRule:
+		return StepRule
+	case Comment:
+		return StepComment
+	case *Category:
+		return StepCategory
+	case Directive:
+		return StepDirective
+	}
+	return StepLine
+}
+
+// joinTraces concatenates a list of traces
+func joinTraces(traces ...Trace) Trace {
+	length := 0
+	for _, t := range traces {
+		length += len(t)
+	}
+	out := make(Trace, 0, length)
+	for _, t := range traces {
+		out = append(out, t...)
+	}
+	return out
+}
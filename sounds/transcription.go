@@ -0,0 +1,127 @@
+package sounds
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/zyxw59/conlang/transcription"
+)
+
+// quantifiers are the regular expression operators which repeat the preceding
+// item. In schemes where they are also symbols, they are only treated as
+// operators after a group, a class, a category, or another quantifier
+const quantifiers = "?*+"
+
+// operators are the regular expression operators which are never transcribed,
+// unless they are part of a longer symbol
+const operators = "()[]|#.^"
+
+// parseTranscription parses the arguments of a transcription directive, which
+// is the name of a scheme from the transcription package. Rules, categories
+// and directives which follow it are converted from that scheme to the IPA.
+// The scheme `ipa` turns conversion off again
+func (rl *RuleList) parseTranscription(args string) error {
+	scheme, err := transcription.Lookup(args)
+	if err != nil {
+		return err
+	}
+	if scheme == transcription.IPA {
+		scheme = nil
+	}
+	rl.settings.scheme = scheme
+	return nil
+}
+
+// transcribe converts a pattern from the transcription scheme of the RuleList
+// to the IPA, leaving references to defined categories and regular expression
+// operators as they are. A pattern of `0` is left as it is
+func (rl *RuleList) transcribe(pattern string) string {
+	scheme := rl.settings.scheme
+	if scheme == nil || pattern == "0" {
+		return pattern
+	}
+	var out strings.Builder
+	// literal is the start of the current run of text to convert
+	literal := 0
+	// quantifiable is whether a quantifier at the current position would
+	// apply to an operator or category
+	quantifiable := false
+	keep := func(i, j int) {
+		out.WriteString(scheme.ToIPA(pattern[literal:i]))
+		out.WriteString(pattern[i:j])
+		literal = j
+	}
+	for i := 0; i < len(pattern); {
+		c := pattern[i]
+		n := scheme.SymbolLen(pattern[i:])
+		// step is the length of the symbol or character at i
+		step := n
+		if step == 0 {
+			_, step = utf8.DecodeRuneInString(pattern[i:])
+		}
+		switch {
+		case n > 1:
+			i += n
+			quantifiable = false
+		case c == '{':
+			m := catMatcher.FindStringSubmatchIndex(pattern[i:])
+			if m != nil && m[0] == 0 {
+				if _, ok := rl.Categories[pattern[i+m[4]:i+m[5]]]; ok {
+					keep(i, i+m[1])
+					i += m[1]
+					quantifiable = true
+					continue
+				}
+			}
+			i += step
+			quantifiable = false
+		case strings.IndexByte(quantifiers, c) >= 0 && (quantifiable || n == 0):
+			keep(i, i+1)
+			i++
+			quantifiable = true
+		case strings.IndexByte(operators, c) >= 0:
+			keep(i, i+1)
+			i++
+			quantifiable = c == ')' || c == ']'
+		default:
+			i += step
+			quantifiable = false
+		}
+	}
+	out.WriteString(scheme.ToIPA(pattern[literal:]))
+	return out.String()
+}
+
+// transcribeRule converts each part of a rule from the transcription scheme
+// of the RuleList to the IPA
+func (rl *RuleList) transcribeRule(r *Rule) {
+	r.From = rl.transcribe(r.From)
+	r.To = rl.transcribe(r.To)
+	r.Before = rl.transcribe(r.Before)
+	r.After = rl.transcribe(r.After)
+	r.UnBefore = rl.transcribe(r.UnBefore)
+	r.UnAfter = rl.transcribe(r.UnAfter)
+}
+
+// transcribeEntry converts the phonemic parts of an orthography entry from the
+// transcription scheme of the RuleList to the IPA. For a romanizer, these are
+// the transliterated text and the environments; for a deromanizer, the
+// replacement
+func (rl *RuleList) transcribeEntry(line string, romanizer bool) string {
+	if rl.settings.scheme == nil {
+		return line
+	}
+	r, err := ParseRule(line)
+	if err != nil {
+		// leave the error to be reported by Orthography.Add
+		return line
+	}
+	if romanizer {
+		to := r.To
+		rl.transcribeRule(r)
+		r.To = to
+	} else {
+		r.To = rl.transcribe(r.To)
+	}
+	return r.String()
+}
@@ -0,0 +1,225 @@
+package sounds
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// nodeMatcher matches a line declaring a node in a tree manifest: the name of
+// the node, optionally followed by `<` and the name of its parent, optionally
+// followed by `:` and the sound change file leading to it from its parent
+var nodeMatcher = regexp.MustCompile(`^(\S+)(?: < (\S+))?(?: : (.+))?$`)
+
+// A Tree is a language tree, in which each node is a language, and the sound
+// changes leading from a language to each of its children are given by a
+// sound change file
+type Tree struct {
+	Nodes map[string]*Node
+	// Roots are the nodes with no parent, in the order they were declared
+	Roots []*Node
+	// Filename is the name of the manifest file the Tree was loaded from,
+	// if any
+	Filename string
+	// last is the node most recently declared, which metadata is added to
+	last *Node
+}
+
+// A Node is a language in a Tree
+type Node struct {
+	Name     string
+	Parent   *Node
+	Children []*Node
+	// File is the sound change file which leads to the language from its
+	// parent, or the empty string if the language has no changes of its
+	// own
+	File string
+	// Metadata holds any other information about the language, such as
+	// its date or display name
+	Metadata map[string]string
+	// Missing is whether the node is implied by the names of its
+	// descendants, but has no file of its own, as described for ScanTree
+	Missing bool
+}
+
+// NewTree initializes an empty Tree
+func NewTree() *Tree {
+	return &Tree{Nodes: make(map[string]*Node)}
+}
+
+// DisplayName returns the `name` metadata of the node, or its name if it has
+// none
+func (n *Node) DisplayName() string {
+	if name, ok := n.Metadata["name"]; ok {
+		return name
+	}
+	return n.Name
+}
+
+// ParseLine parses a line of a tree manifest, adding it to the Tree. A line is
+// either a node, of the form `name < parent : file`, where the parent and file
+// are optional, an indented line of metadata for the node above it, of the
+// form `key = value`, a comment, or blank. The parent must be declared before
+// the node. Relative filenames are relative to the directory of the manifest
+func (t *Tree) ParseLine(line string) error {
+	trimmed := strings.TrimSpace(line)
+	switch {
+	case len(trimmed) == 0, strings.HasPrefix(trimmed, commentstr):
+		// nothing to do
+	case line != strings.TrimLeft(line, " \t"):
+		// indented, so it's metadata
+		if t.last == nil {
+			return fmt.Errorf("tree error: metadata `%s` does not follow a node", trimmed)
+		}
+		split := strings.SplitN(trimmed, equalstr, 2)
+		if len(split) < 2 {
+			return fmt.Errorf("tree error: `%s` is not valid metadata", trimmed)
+		}
+		if t.last.Metadata == nil {
+			t.last.Metadata = make(map[string]string)
+		}
+		t.last.Metadata[strings.TrimSpace(split[0])] = strings.TrimSpace(split[1])
+	default:
+		m := nodeMatcher.FindStringSubmatch(trimmed)
+		if m == nil {
+			return fmt.Errorf("tree error: `%s` is not a valid node", trimmed)
+		}
+		if _, ok := t.Nodes[m[1]]; ok {
+			return fmt.Errorf("tree error: node %#v is already defined", m[1])
+		}
+		n := &Node{Name: m[1], File: strings.TrimSpace(m[3])}
+		if n.File != "" && !filepath.IsAbs(n.File) && t.Filename != "" {
+			n.File = filepath.Join(filepath.Dir(t.Filename), n.File)
+		}
+		if m[2] != "" {
+			parent, ok := t.Nodes[m[2]]
+			if !ok {
+				return fmt.Errorf("tree error: parent %#v of %#v is not defined", m[2], m[1])
+			}
+			n.Parent = parent
+			parent.Children = append(parent.Children, n)
+		} else {
+			t.Roots = append(t.Roots, n)
+		}
+		t.Nodes[n.Name] = n
+		t.last = n
+	}
+	return nil
+}
+
+// LoadTree loads a tree manifest file as a Tree
+func LoadTree(filename string) (*Tree, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadTree(f, filename)
+}
+
+// ReadTree reads the contents of a tree manifest file as a Tree. The filename
+// is used to find the sound change files it refers to
+func ReadTree(r io.Reader, filename string) (*Tree, error) {
+	t := NewTree()
+	t.Filename = filename
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if err := t.ParseLine(scanner.Text()); err != nil {
+			return nil, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Node returns the node with the given name
+func (t *Tree) Node(name string) (*Node, error) {
+	n, ok := t.Nodes[name]
+	if !ok {
+		return nil, fmt.Errorf("tree error: node %#v is not defined", name)
+	}
+	return n, nil
+}
+
+// lineage returns the nodes from the root of the tree down to the named node,
+// or nothing if the name is empty
+func (t *Tree) lineage(name string) ([]*Node, error) {
+	if name == "" {
+		return nil, nil
+	}
+	n, err := t.Node(name)
+	if err != nil {
+		return nil, err
+	}
+	var nodes []*Node
+	for ; n != nil; n = n.Parent {
+		nodes = append([]*Node{n}, nodes...)
+	}
+	return nodes, nil
+}
+
+// Descent returns the files which lead down the tree from one node to
+// another, which must be its descendant. An empty first name is above the
+// roots of the tree, so the files lead from the root to the second node
+func (t *Tree) Descent(from, to string) ([]string, error) {
+	_, up, down, err := t.route(from, to)
+	if err != nil {
+		return nil, err
+	}
+	if len(up) > 0 {
+		return nil, fmt.Errorf("tree error: %#v is not a descendant of %#v", to, from)
+	}
+	return nodeFiles(down), nil
+}
+
+// Route returns the route through the tree from one node to another, as
+// described for the function Route: the files up must be reversed, from last
+// to first, to reach the closest common ancestor of the two, and the files
+// down must then be applied. The files above lead from the root down to the
+// common ancestor. Nodes with no file are skipped
+func (t *Tree) Route(from, to string) (above, up, down []string, err error) {
+	aboveNodes, upNodes, downNodes, err := t.route(from, to)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return nodeFiles(aboveNodes), nodeFiles(upNodes), nodeFiles(downNodes), nil
+}
+
+// route returns the nodes on the route through the tree from one node to
+// another, below their closest common ancestor, along with the nodes above
+// them, from the root down to the ancestor itself
+func (t *Tree) route(from, to string) (above, up, down []*Node, err error) {
+	fromNodes, err := t.lineage(from)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	toNodes, err := t.lineage(to)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	common := 0
+	for common < len(fromNodes) && common < len(toNodes) && fromNodes[common] == toNodes[common] {
+		common++
+	}
+	if common == 0 && len(fromNodes) > 0 && len(toNodes) > 0 {
+		return nil, nil, nil, fmt.Errorf("tree error: %#v and %#v have no common ancestor", from, to)
+	}
+	return fromNodes[:common], fromNodes[common:], toNodes[common:], nil
+}
+
+// nodeFiles returns the files of a list of nodes, skipping nodes with no file
+func nodeFiles(nodes []*Node) []string {
+	files := make([]string, 0, len(nodes))
+	for _, n := range nodes {
+		if n.File != "" {
+			files = append(files, n.File)
+		}
+	}
+	return files
+}
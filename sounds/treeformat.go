@@ -0,0 +1,68 @@
+package sounds
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ASCII draws the tree as text, with each node on its own line, indented below
+// its parent. Nodes with a display name different from their name show it in
+// parentheses, and missing nodes are marked as such
+func (t *Tree) ASCII() string {
+	var b strings.Builder
+	for _, root := range t.Roots {
+		b.WriteString(root.label())
+		b.WriteString("\n")
+		writeChildren(&b, root, "")
+	}
+	return b.String()
+}
+
+// writeChildren draws the children of a node, each preceded by the given
+// indentation
+func writeChildren(b *strings.Builder, n *Node, indent string) {
+	for i, child := range n.Children {
+		branch, next := "|-- ", "|   "
+		if i == len(n.Children)-1 {
+			branch, next = "`-- ", "    "
+		}
+		fmt.Fprintf(b, "%s%s%s\n", indent, branch, child.label())
+		writeChildren(b, child, indent+next)
+	}
+}
+
+// label describes a node for drawing the tree
+func (n *Node) label() string {
+	label := n.Name
+	if name := n.DisplayName(); name != n.Name {
+		label = fmt.Sprintf("%s (%s)", n.Name, name)
+	}
+	if n.Missing {
+		label += " [missing]"
+	}
+	return label
+}
+
+// DOT writes the tree in the Graphviz DOT language, with an edge from each
+// node to each of its children. Missing nodes are drawn with dashed outlines
+func (t *Tree) DOT() string {
+	var b strings.Builder
+	b.WriteString("digraph tree {\n")
+	var write func(n *Node)
+	write = func(n *Node) {
+		attrs := fmt.Sprintf("label=%q", n.DisplayName())
+		if n.Missing {
+			attrs += " style=dashed"
+		}
+		fmt.Fprintf(&b, "\t%q [%s];\n", n.Name, attrs)
+		for _, child := range n.Children {
+			fmt.Fprintf(&b, "\t%q -> %q;\n", n.Name, child.Name)
+			write(child)
+		}
+	}
+	for _, root := range t.Roots {
+		write(root)
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
@@ -0,0 +1,63 @@
+package sounds
+
+import (
+	"sort"
+	"strings"
+)
+
+// A Word is a word, along with a set of tags describing it, such as its part
+// of speech, register, or origin
+type Word struct {
+	Text string
+	Tags Tags
+}
+
+// ParseWord parses a line of input as a word. The text of the word is
+// separated from its tags by a tab, and the tags are separated by whitespace.
+// A line without a tab is a word with no tags
+func ParseWord(line string) Word {
+	split := strings.SplitN(line, "\t", 2)
+	w := Word{Text: split[0]}
+	if len(split) > 1 {
+		w.Tags = NewTags(strings.Fields(split[1])...)
+	}
+	return w
+}
+
+// String writes the word as it would be read by ParseWord
+func (w Word) String() string {
+	if len(w.Tags) == 0 {
+		return w.Text
+	}
+	return w.Text + "\t" + w.Tags.String()
+}
+
+// Tags is a set of tags
+type Tags map[string]bool
+
+// NewTags returns a set containing the given tags
+func NewTags(tags ...string) Tags {
+	t := make(Tags, len(tags))
+	for _, tag := range tags {
+		t[tag] = true
+	}
+	return t
+}
+
+// Has reports whether the set contains a tag. It is safe to call on a nil
+// set, which contains no tags
+func (t Tags) Has(tag string) bool {
+	return t[tag]
+}
+
+// String writes the tags in sorted order, separated by spaces
+func (t Tags) String() string {
+	tags := make([]string, 0, len(t))
+	for tag, ok := range t {
+		if ok {
+			tags = append(tags, tag)
+		}
+	}
+	sort.Strings(tags)
+	return strings.Join(tags, " ")
+}
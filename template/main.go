@@ -35,6 +35,21 @@ func main() {
 			output, _, err := cache.ApplyPairs(word, *prefix, names...)
 			return output, err
 		},
+		"ApplyPairsStages": func(word string, names ...string) ([]string, error) {
+			files, err := sounds.PairFiles(*prefix, names...)
+			if err != nil {
+				return nil, err
+			}
+			res, err := cache.ApplyChain(sounds.Word{Text: word}, files...)
+			if err != nil {
+				return nil, err
+			}
+			outputs := make([]string, len(res.Stages))
+			for i, st := range res.Stages {
+				outputs[i] = st.Output.Text
+			}
+			return outputs, nil
+		},
 		"Execute": func(templ, word string) (string, error) {
 			wr := new(bytes.Buffer)
 			err := t.ExecuteTemplate(wr, templ, word)
@@ -0,0 +1,103 @@
+package transcription
+
+import "strings"
+
+// IPA is the identity scheme, which leaves text unchanged
+var IPA = newScheme("ipa", nil, nil)
+
+// XSAMPA is the Extended Speech Assessment Methods Phonetic Alphabet
+var XSAMPA = newScheme("xsampa", xsampaPairs, xsampaAliases)
+
+// CXS is Conlang X-SAMPA. It has the same symbols as X-SAMPA for the sounds
+// and diacritics covered here, except that implosives are written with `<`
+// rather than `_<`, as in `b<`
+var CXS = newScheme("cxs", cxsPairs(), xsampaAliases)
+
+// Kirshenbaum is the Kirshenbaum ASCII-IPA scheme
+var Kirshenbaum = newScheme("kirshenbaum", kirshenbaumPairs, kirshenbaumAliases)
+
+var xsampaPairs = []pair{
+	// consonants and vowels written with lower case letters
+	{"a", "a"}, {"b", "b"}, {"b_<", "ɓ"}, {"c", "c"}, {"d", "d"},
+	{"d`", "ɖ"}, {"d_<", "ɗ"}, {"e", "e"}, {"f", "f"}, {"g", "g"},
+	{"g_<", "ɠ"}, {"h", "h"}, {"h\\", "ɦ"}, {"i", "i"}, {"j", "j"},
+	{"j\\", "ʝ"}, {"k", "k"}, {"l", "l"}, {"l`", "ɭ"}, {"l\\", "ɺ"},
+	{"m", "m"}, {"n", "n"}, {"n`", "ɳ"}, {"o", "o"}, {"p", "p"},
+	{"p\\", "ɸ"}, {"q", "q"}, {"r", "r"}, {"r`", "ɽ"}, {"r\\", "ɹ"},
+	{"r\\`", "ɻ"}, {"s", "s"}, {"s`", "ʂ"}, {"s\\", "ɕ"}, {"t", "t"},
+	{"t`", "ʈ"}, {"u", "u"}, {"v", "v"}, {"P", "ʋ"}, {"v\\", "ʋ"},
+	{"w", "w"}, {"x", "x"}, {"x\\", "ɧ"}, {"y", "y"}, {"z", "z"},
+	{"z`", "ʐ"}, {"z\\", "ʑ"},
+	// consonants and vowels written with upper case letters
+	{"A", "ɑ"}, {"B", "β"}, {"B\\", "ʙ"}, {"C", "ç"}, {"D", "ð"},
+	{"E", "ɛ"}, {"F", "ɱ"}, {"G", "ɣ"}, {"G\\", "ɢ"}, {"G\\_<", "ʛ"},
+	{"H", "ɥ"}, {"H\\", "ʜ"}, {"I", "ɪ"}, {"I\\", "ᵻ"}, {"J", "ɲ"},
+	{"J\\", "ɟ"}, {"J\\_<", "ʄ"}, {"K", "ɬ"}, {"K\\", "ɮ"}, {"L", "ʎ"},
+	{"L\\", "ʟ"}, {"M", "ɯ"}, {"M\\", "ɰ"}, {"N", "ŋ"}, {"N\\", "ɴ"},
+	{"O", "ɔ"}, {"O\\", "ʘ"}, {"Q", "ɒ"}, {"R", "ʁ"}, {"R\\", "ʀ"},
+	{"S", "ʃ"}, {"T", "θ"}, {"U", "ʊ"}, {"U\\", "ᵿ"}, {"V", "ʌ"},
+	{"W", "ʍ"}, {"X", "χ"}, {"X\\", "ħ"}, {"Y", "ʏ"}, {"Z", "ʒ"},
+	// other symbols
+	{"\"", "ˈ"}, {"%", "ˌ"}, {":", "ː"}, {":\\", "ˑ"},
+	{"@", "ə"}, {"@\\", "ɘ"}, {"@`", "ɚ"}, {"{", "æ"}, {"}", "ʉ"},
+	{"1", "ɨ"}, {"2", "ø"}, {"3", "ɜ"}, {"3\\", "ɞ"}, {"4", "ɾ"},
+	{"5", "ɫ"}, {"6", "ɐ"}, {"7", "ɤ"}, {"8", "ɵ"}, {"9", "œ"},
+	{"&", "ɶ"}, {"?", "ʔ"}, {"?\\", "ʕ"}, {"<\\", "ʢ"}, {">\\", "ʡ"},
+	{"^", "ꜛ"}, {"!", "ꜜ"}, {"!\\", "ǃ"}, {"|\\", "ǀ"}, {"||", "‖"},
+	{"|\\|\\", "ǁ"}, {"=\\", "ǂ"}, {"-\\", "‿"},
+	// diacritics
+	{"_\"", "̈"}, {"_+", "̟"}, {"_-", "̠"},
+	{"_/", "̌"}, {"_0", "̥"}, {"=", "̩"}, {"_=", "̩"},
+	{"_>", "ʼ"}, {"_?\\", "ˤ"}, {"_\\", "̂"}, {"_^", "̯"},
+	{"_}", "̚"}, {"`", "˞"}, {"~", "̃"}, {"_~", "̃"},
+	{"_A", "̘"}, {"_a", "̺"}, {"_B", "̏"},
+	{"_c", "̜"}, {"_d", "̪"}, {"_e", "̴"},
+	{"<F>", "↘"}, {"_F", "̂"}, {"_G", "ˠ"}, {"_H", "́"},
+	{"_h", "ʰ"}, {"_j", "ʲ"}, {"'", "ʲ"}, {"_k", "̰"}, {"_L", "̀"},
+	{"_l", "ˡ"}, {"_M", "̄"}, {"_m", "̻"}, {"_N", "̼"},
+	{"_n", "ⁿ"}, {"_O", "̹"}, {"_o", "̞"}, {"_q", "̙"},
+	{"<R>", "↗"}, {"_R", "̌"}, {"_r", "̝"}, {"_T", "̋"},
+	{"_t", "̤"}, {"_v", "̬"}, {"_w", "ʷ"}, {"_X", "̆"},
+	{"_x", "̽"},
+}
+
+var xsampaAliases = []pair{
+	{"g", "ɡ"},
+}
+
+// cxsPairs returns the X-SAMPA pairs, with the implosives written as in CXS
+func cxsPairs() []pair {
+	pairs := make([]pair, len(xsampaPairs))
+	for i, p := range xsampaPairs {
+		if strings.HasSuffix(p.ascii, "_<") {
+			p.ascii = strings.TrimSuffix(p.ascii, "_<") + "<"
+		}
+		pairs[i] = p
+	}
+	return pairs
+}
+
+var kirshenbaumPairs = []pair{
+	// consonants
+	{"p", "p"}, {"b", "b"}, {"t", "t"}, {"d", "d"}, {"t.", "ʈ"},
+	{"d.", "ɖ"}, {"c", "c"}, {"J", "ɟ"}, {"k", "k"}, {"g", "g"},
+	{"q", "q"}, {"G", "ɢ"}, {"?", "ʔ"}, {"m", "m"}, {"M", "ɱ"},
+	{"n", "n"}, {"n.", "ɳ"}, {"n^", "ɲ"}, {"N", "ŋ"}, {"n\"", "ɴ"},
+	{"r", "r"}, {"r\"", "ʀ"}, {"*", "ɾ"}, {"P", "ɸ"}, {"B", "β"},
+	{"f", "f"}, {"v", "v"}, {"T", "θ"}, {"D", "ð"}, {"s", "s"},
+	{"z", "z"}, {"S", "ʃ"}, {"Z", "ʒ"}, {"s.", "ʂ"}, {"z.", "ʐ"},
+	{"C", "ç"}, {"x", "x"}, {"Q", "ɣ"}, {"X", "χ"}, {"g\"", "ʁ"},
+	{"H", "ħ"}, {"h", "h"}, {"r.", "ɻ"}, {"j", "j"}, {"l", "l"},
+	{"l.", "ɭ"}, {"l^", "ʎ"}, {"L", "ʟ"}, {"w", "w"},
+	// vowels
+	{"i", "i"}, {"y", "y"}, {"i\"", "ɨ"}, {"u\"", "ʉ"}, {"u", "u"},
+	{"I", "ɪ"}, {"U", "ʊ"}, {"e", "e"}, {"Y", "ø"}, {"o", "o"},
+	{"@", "ə"}, {"E", "ɛ"}, {"W", "œ"}, {"V", "ʌ"}, {"O", "ɔ"},
+	{"&", "æ"}, {"a", "a"}, {"A", "ɑ"},
+	// suprasegmentals and diacritics
+	{":", "ː"}, {"'", "ˈ"}, {",", "ˌ"}, {"~", "̃"},
+}
+
+var kirshenbaumAliases = []pair{
+	{"g", "ɡ"},
+}
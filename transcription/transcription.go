@@ -0,0 +1,138 @@
+// Package transcription converts between the International Phonetic Alphabet
+// and ASCII transcription schemes such as X-SAMPA and Kirshenbaum.
+package transcription
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// A Scheme is an ASCII transcription scheme for the IPA
+type Scheme struct {
+	Name string
+	// toIPA and fromIPA are the tables for converting in each direction
+	toIPA, fromIPA *table
+}
+
+// a pair is a single correspondence between an ASCII symbol and an IPA symbol
+type pair struct {
+	ascii, ipa string
+}
+
+// newScheme creates a scheme from a list of correspondences. When more than
+// one ASCII symbol corresponds to the same IPA symbol, the first is used when
+// converting from the IPA. The aliases are additional IPA symbols which are
+// converted to ASCII, but are never produced when converting to the IPA
+func newScheme(name string, pairs []pair, aliases []pair) *Scheme {
+	to := make(map[string]string)
+	from := make(map[string]string)
+	for _, p := range pairs {
+		if _, ok := to[p.ascii]; !ok {
+			to[p.ascii] = p.ipa
+		}
+		if _, ok := from[norm.NFD.String(p.ipa)]; !ok {
+			from[norm.NFD.String(p.ipa)] = p.ascii
+		}
+	}
+	for _, p := range aliases {
+		if _, ok := from[norm.NFD.String(p.ipa)]; !ok {
+			from[norm.NFD.String(p.ipa)] = p.ascii
+		}
+	}
+	return &Scheme{Name: name, toIPA: newTable(to), fromIPA: newTable(from)}
+}
+
+// ToIPA converts text in the scheme to the IPA. Characters which are not part
+// of any symbol in the scheme are left as they are
+func (s *Scheme) ToIPA(text string) string {
+	return s.toIPA.convert(text)
+}
+
+// FromIPA converts text in the IPA to the scheme. The text is decomposed
+// first, so that precomposed characters such as `ã` are converted to a base
+// and a diacritic. Characters which are not part of any symbol in the scheme
+// are left as they are
+func (s *Scheme) FromIPA(text string) string {
+	return s.fromIPA.convert(norm.NFD.String(text))
+}
+
+// SymbolLen returns the length in bytes of the longest symbol of the scheme
+// at the start of text, or 0 if no symbol starts there
+func (s *Scheme) SymbolLen(text string) int {
+	return len(s.toIPA.prefix(text))
+}
+
+// String returns the name of the scheme
+func (s *Scheme) String() string {
+	return s.Name
+}
+
+// a table converts text by replacing the longest symbol at each point
+type table struct {
+	// keys are sorted from longest to shortest
+	keys   []string
+	values map[string]string
+}
+
+func newTable(values map[string]string) *table {
+	t := &table{values: values, keys: make([]string, 0, len(values))}
+	for k := range values {
+		t.keys = append(t.keys, k)
+	}
+	sort.Slice(t.keys, func(i, j int) bool {
+		if len(t.keys[i]) != len(t.keys[j]) {
+			return len(t.keys[i]) > len(t.keys[j])
+		}
+		return t.keys[i] < t.keys[j]
+	})
+	return t
+}
+
+// prefix returns the longest key at the start of text, or the empty string if
+// there is none
+func (t *table) prefix(text string) string {
+	for _, k := range t.keys {
+		if strings.HasPrefix(text, k) {
+			return k
+		}
+	}
+	return ""
+}
+
+func (t *table) convert(text string) string {
+	var out strings.Builder
+	for len(text) > 0 {
+		if k := t.prefix(text); k != "" {
+			out.WriteString(t.values[k])
+			text = text[len(k):]
+			continue
+		}
+		_, n := utf8.DecodeRuneInString(text)
+		out.WriteString(text[:n])
+		text = text[n:]
+	}
+	return out.String()
+}
+
+// schemes are the available schemes, by name
+var schemes = map[string]*Scheme{
+	"xsampa":      XSAMPA,
+	"x-sampa":     XSAMPA,
+	"kirshenbaum": Kirshenbaum,
+	"cxs":         CXS,
+	"ipa":         IPA,
+}
+
+// Lookup returns the scheme with the given name, ignoring case. The names are
+// `xsampa` (or `x-sampa`), `kirshenbaum`, `cxs` and `ipa`
+func Lookup(name string) (*Scheme, error) {
+	s, ok := schemes[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("transcription error: unknown scheme %#v", name)
+	}
+	return s, nil
+}
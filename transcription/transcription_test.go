@@ -0,0 +1,82 @@
+package transcription
+
+import "testing"
+
+func TestConvert(t *testing.T) {
+	tables := []struct {
+		scheme *Scheme
+		ascii  string
+		ipa    string
+	}{
+		{XSAMPA, "", ""},
+		{XSAMPA, "S@n", "ʃən"},
+		{XSAMPA, "t_hOk", "tʰɔk"},
+		{XSAMPA, "r\\`a:", "ɻaː"},
+		{XSAMPA, "\"{p_>l", "ˈæpʼl"},
+		{XSAMPA, "|\\|\\a?", "ǁaʔ"},
+		{XSAMPA, "ba~", "ba\u0303"},
+		{XSAMPA, "s_j", "sʲ"},
+		{XSAMPA, "n=", "n̩"},
+		{XSAMPA, "b_<ad_<", "ɓaɗ"},
+		{CXS, "J\\<aN", "ʄaŋ"},
+		{CXS, "b<ad<", "ɓaɗ"},
+		{CXS, "t_hOk", "tʰɔk"},
+		{Kirshenbaum, "TIN", "θɪŋ"},
+		{Kirshenbaum, "n^a:t.", "ɲaːʈ"},
+		{Kirshenbaum, "'&p@l", "ˈæpəl"},
+		{IPA, "S@n", "S@n"},
+	}
+	for _, tab := range tables {
+		if out := tab.scheme.ToIPA(tab.ascii); out != tab.ipa {
+			t.Errorf("%v.ToIPA(%#v) produced %#v instead of %#v", tab.scheme, tab.ascii, out, tab.ipa)
+		}
+		if out := tab.scheme.FromIPA(tab.ipa); out != tab.ascii {
+			t.Errorf("%v.FromIPA(%#v) produced %#v instead of %#v", tab.scheme, tab.ipa, out, tab.ascii)
+		}
+	}
+}
+
+func TestFromIPAAliases(t *testing.T) {
+	tables := []struct {
+		scheme *Scheme
+		ipa    string
+		ascii  string
+	}{
+		{XSAMPA, "ɡa", "ga"},
+		{XSAMPA, "ʋa", "Pa"},
+		{XSAMPA, "\u00e3ː", "a~:"},
+		{Kirshenbaum, "ɡʊd", "gUd"},
+		{CXS, "ɡɐ", "g6"},
+	}
+	for _, tab := range tables {
+		if out := tab.scheme.FromIPA(tab.ipa); out != tab.ascii {
+			t.Errorf("%v.FromIPA(%#v) produced %#v instead of %#v", tab.scheme, tab.ipa, out, tab.ascii)
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	tables := []struct {
+		name   string
+		scheme *Scheme
+		err    bool
+	}{
+		{"xsampa", XSAMPA, false},
+		{"X-SAMPA", XSAMPA, false},
+		{"kirshenbaum", Kirshenbaum, false},
+		{"cxs", CXS, false},
+		{"ipa", IPA, false},
+		{"sampa", nil, true},
+	}
+	for _, tab := range tables {
+		s, err := Lookup(tab.name)
+		switch {
+		case tab.err && err == nil:
+			t.Errorf("Lookup(%#v) failed to produce an error", tab.name)
+		case !tab.err && err != nil:
+			t.Errorf("Lookup(%#v) incorrectly produced the error %v", tab.name, err)
+		case s != tab.scheme:
+			t.Errorf("Lookup(%#v) produced %v instead of %v", tab.name, s, tab.scheme)
+		}
+	}
+}